@@ -1,8 +1,14 @@
 package cli
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"sqlcmp/config"
+	"sqlcmp/datasource"
+	"sqlcmp/datasource/credentials"
 	"sqlcmp/datasource/dsn"
 	"strings"
 	"syscall"
@@ -19,6 +25,14 @@ type SourceConfig struct {
 	Tables            []string
 	ExcludeTables     []string
 	PromptForPassword bool
+	// FromPassword and ToPassword are where the passwords of the sources come
+	// from when they're set
+	FromPassword, ToPassword credentials.Source
+	// Rules holds the comparison rules of each table from the config file
+	Rules map[string]config.Table
+	// Renames maps the tables and columns of the from source to their names in
+	// the to source
+	Renames datasource.Renames
 }
 
 var sharedFlags = []cli.Flag{
@@ -37,6 +51,16 @@ var sharedFlags = []cli.Flag{
 		Aliases: []string{"p"},
 		Usage:   "Prompt for password",
 	},
+	&cli.StringFlag{
+		Name:    "from-password-source",
+		Usage:   "Where the from-dsn password comes from: env:VAR, file:PATH, cmd:COMMAND, mycnf[:PATH], pgpass[:PATH] or prompt",
+		EnvVars: []string{"SQLCMP_FROM_PASSWORD_SOURCE"},
+	},
+	&cli.StringFlag{
+		Name:    "to-password-source",
+		Usage:   "Where the to-dsn password comes from: env:VAR, file:PATH, cmd:COMMAND, mycnf[:PATH], pgpass[:PATH] or prompt",
+		EnvVars: []string{"SQLCMP_TO_PASSWORD_SOURCE"},
+	},
 	&cli.StringSliceFlag{
 		Name:  "include-tables",
 		Usage: "Tables to compare",
@@ -45,6 +69,19 @@ var sharedFlags = []cli.Flag{
 		Name:  "exclude-tables",
 		Usage: "Tables to exclude from comparison",
 	},
+	&cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "Stop the command after this long, e.g. 30m",
+	},
+	&cli.StringFlag{
+		Name:    "config",
+		Usage:   "Config file with named connections and table rules, sqlcmp.yaml is looked for in the current directory and its parents within the git repository by default",
+		EnvVars: []string{"SQLCMP_CONFIG"},
+	},
+	&cli.BoolFlag{
+		Name:  "show-secrets",
+		Usage: "Show passwords and secret params of dsns in messages and reports, for debugging",
+	},
 }
 
 var App = &cli.App{
@@ -54,23 +91,96 @@ var App = &cli.App{
 	Commands: []*cli.Command{
 		diffCmd,
 		schemaCmd,
+		schemaDiffCmd,
+		syncCmd,
 		checkFkCmd,
 	},
 }
 
-func flagsToSources(ctx *cli.Context) (sources SourceConfig) {
-	sources.FromDSN = ctx.String("from-dsn")
-	sources.ToDSN = ctx.String("to-dsn")
-	for _, table := range ctx.StringSlice("include-tables") {
-		sources.Tables = append(sources.Tables, strings.Split(table, ",")...)
+// loadSources merges the flags and arguments of a command over the config file.
+// The sources are given by --from-dsn and --to-dsn or as arguments, either as
+// dsns or as the names of connections in the config file.
+func loadSources(ctx *cli.Context) (sources SourceConfig, err error) {
+	dsn.ShowSecrets = ctx.Bool("show-secrets")
+	cfg, err := loadConfig(ctx)
+	if err != nil {
+		return
+	}
+	args := ctx.Args().Slice()
+	if len(args) > 2 {
+		return sources, fmt.Errorf("expected at most two sources but got %d arguments, flags have to come before the sources", len(args))
+	}
+	sources.FromDSN, sources.ToDSN = ctx.String("from-dsn"), ctx.String("to-dsn")
+	if len(args) > 0 && sources.FromDSN == "" {
+		sources.FromDSN, args = args[0], args[1:]
+	}
+	if len(args) > 0 && sources.ToDSN == "" {
+		sources.ToDSN, args = args[0], args[1:]
+	}
+	if len(args) > 0 {
+		return sources, fmt.Errorf("sources given as arguments and flags: %s", strings.Join(args, " "))
+	}
+	from, err := cfg.Connection(sources.FromDSN)
+	if err != nil {
+		return
+	}
+	to, err := cfg.Connection(sources.ToDSN)
+	if err != nil {
+		return
+	}
+	sources.FromDSN, sources.ToDSN = from.DSN, to.DSN
+	if sources.FromPassword, err = passwordSource(ctx.String("from-password-source"), from.PasswordSource); err != nil {
+		return
+	}
+	if sources.ToPassword, err = passwordSource(ctx.String("to-password-source"), to.PasswordSource); err != nil {
+		return
+	}
+
+	sources.Tables, sources.ExcludeTables = cfg.IncludeTables, cfg.ExcludeTables
+	if ctx.IsSet("include-tables") {
+		sources.Tables = nil
+		for _, table := range ctx.StringSlice("include-tables") {
+			sources.Tables = append(sources.Tables, strings.Split(table, ",")...)
+		}
 	}
-	for _, table := range ctx.StringSlice("exclude-tables") {
-		sources.ExcludeTables = append(sources.ExcludeTables, strings.Split(table, ",")...)
+	if ctx.IsSet("exclude-tables") {
+		sources.ExcludeTables = nil
+		for _, table := range ctx.StringSlice("exclude-tables") {
+			sources.ExcludeTables = append(sources.ExcludeTables, strings.Split(table, ",")...)
+		}
 	}
 	sources.PromptForPassword = ctx.Bool("password")
+	sources.Rules = cfg.Tables
+	sources.Renames, err = loadRenames(ctx, cfg.Tables)
 	return
 }
 
+// passwordSource parses the password source of the flag, or of the connection
+// when the flag isn't set.
+func passwordSource(flag, connection string) (source credentials.Source, err error) {
+	if flag == "" {
+		flag = connection
+	}
+	if flag == "" {
+		return
+	}
+	return credentials.ParseSource(flag)
+}
+
+// loadConfig reads the --config file or the config file found in the current
+// directory or its parents within the repository. It returns an empty config
+// when there is none.
+func loadConfig(ctx *cli.Context) (cfg *config.Config, err error) {
+	path := ctx.String("config")
+	if path == "" {
+		if path, err = config.Find("."); err != nil || path == "" {
+			return &config.Config{}, err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "using config %s\n", path)
+	return config.Load(path)
+}
+
 func ensurePassword(cfg *dsn.DataSourceConfig, prompt string) (err error) {
 	if cfg.Password == "" {
 		if prompt == "" {
@@ -101,6 +211,61 @@ func ensurePasswords(toCfg, fromCfg *dsn.DataSourceConfig) (err error) {
 	return
 }
 
+// openSource parses the dsn, reads the password from its source or asks for it
+// when required, and opens the data source.
+func openSource(ctx context.Context, rawDsn string, password credentials.Source, promptForPassword bool, prompt string) (source datasource.DataSource, err error) {
+	cfg, err := dsn.Parse(rawDsn)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid dsn: %s\n%w", dsn.Redact(rawDsn), err)
+	}
+	switch password.Kind {
+	case "":
+	case credentials.Prompt:
+		cfg.Password, promptForPassword = "", true
+	default:
+		if cfg.Password, err = password.Password(ctx, cfg); err != nil {
+			return
+		}
+	}
+	if promptForPassword {
+		if err = ensurePassword(&cfg, prompt); err != nil {
+			return
+		}
+	}
+	return datasource.Open(cfg)
+}
+
+// commandContext returns a context that is cancelled by SIGINT, SIGTERM or when
+// --timeout passes, which stops the queries of the command and releases their
+// connections. It's created after any password prompts so they still respond to
+// Ctrl-C and don't count towards the timeout.
+func commandContext(cCtx *cli.Context) (ctx context.Context, cancel context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(cCtx.Context, os.Interrupt, syscall.SIGTERM)
+	timeout := cCtx.Duration("timeout")
+	if timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancelTimeout := context.WithTimeout(ctx, timeout)
+	return ctx, func() {
+		cancelTimeout()
+		stop()
+	}
+}
+
+// contextError explains errors caused by the command's context ending.
+func contextError(ctx context.Context, err error) error {
+	switch {
+	case failure(err) == nil:
+		// findings keep their exit code
+		return err
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("timed out:\n%w", err)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("interrupted:\n%w", err)
+	}
+	return err
+}
+
 func filterTables(tables []string, include []string, exclude []string) []string {
 	res := make([]string, 0, len(tables))
 	for _, table := range tables {
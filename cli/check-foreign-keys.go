@@ -3,40 +3,56 @@ package cli
 import (
 	"fmt"
 	"os"
-	"sqlcmp/datasource"
-	"sqlcmp/datasource/dsn"
+	"sqlcmp/datasource/dialect"
+	"sqlcmp/datasource/schema"
+	"sqlcmp/report"
 	"strings"
+	"time"
 
 	"github.com/urfave/cli/v2"
 )
 
 var checkFkCmd = &cli.Command{
-	Name:  "check-foreign-keys",
-	Usage: "check foreign keys on a single data source",
-	Flags: sharedFlags,
+	Name:      "check-foreign-keys",
+	ArgsUsage: "[source]",
+	Usage:     "check foreign keys on a single data source",
+	Flags:     append([]cli.Flag{junitFlag, failOnFlag("orphans")}, sharedFlags...),
 	Action: func(cCtx *cli.Context) (err error) {
-		sources := flagsToSources(cCtx)
+		sources, err := loadSources(cCtx)
+		if err != nil {
+			return err
+		}
 		if sources.FromDSN == "" {
 			return fmt.Errorf("from-dsn is required")
 		}
 
-		cfg, err := dsn.Parse(sources.FromDSN)
+		db, err := openSource(cCtx.Context, sources.FromDSN, sources.FromPassword, sources.PromptForPassword, "")
 		if err != nil {
 			return err
 		}
-		if sources.PromptForPassword {
-			if err = ensurePassword(&cfg, ""); err != nil {
-				return
-			}
+		defer db.Close()
+		d, err := targetDialect("", sources.FromDSN)
+		if err != nil {
+			return err
 		}
-
-		db, err := datasource.Open(cfg)
+		ctx, cancel := commandContext(cCtx)
+		defer cancel()
+		defer func() { err = contextError(ctx, err) }()
+		found, err := newFindings(cCtx, "orphans")
 		if err != nil {
 			return err
 		}
-		defer db.Close()
+		junit, finishJUnit, err := junitFile(cCtx, "check-foreign-keys")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if endErr := finishJUnit(contextError(ctx, err)); err == nil {
+				err = endErr
+			}
+		}()
 
-		tableNames, err := db.GetTableNames()
+		tableNames, err := db.GetTableNamesContext(ctx)
 		if err != nil {
 			return err
 		}
@@ -44,7 +60,7 @@ var checkFkCmd = &cli.Command{
 		tableNames = filterTables(tableNames, sources.Tables, sources.ExcludeTables)
 		fmt.Fprintln(os.Stderr, "Tables: ", strings.Join(tableNames, ","))
 
-		tables, err := db.GetSchema(tableNames)
+		tables, err := db.GetSchemaContext(ctx, tableNames)
 		if err != nil {
 			return err
 		}
@@ -52,26 +68,41 @@ var checkFkCmd = &cli.Command{
 		for _, table := range tables {
 			fmt.Fprintln(os.Stderr, "checking table", table.Name)
 			for _, fk := range table.ForeignKeys {
+				started := time.Now()
 				// fmt.Fprintln(os.Stderr, "checking foreign key", fk.Name)
 				// select count(distinct geo_id) from respondent_geo where geo_id not in (select id from geo)
-				q := fmt.Sprintf("SELECT COUNT(DISTINCT `%s`) FROM `%s` WHERE `%s` NOT IN (SELECT `%s` FROM `%s`)", fk.FromColumn, fk.From, fk.FromColumn, fk.ToColumn, fk.To)
+				q, orphans := orphanQueries(d, fk)
 				// fmt.Fprintln(os.Stderr, q)
-				row := db.DB().QueryRow(q)
-				if row.Err() != nil {
+				row := db.DB().QueryRowContext(ctx, q)
+				if err = row.Err(); err != nil {
 					return fmt.Errorf("failed to query foreign key %s: %w", fk.Name, err)
 				}
 				var count int
 				if err = row.Scan(&count); err != nil {
 					return fmt.Errorf("failed to scan foreign key %s: %w", fk.Name, err)
 				}
+				c := report.TestCase{Name: fmt.Sprintf("%s.%s references %s.%s", fk.From, fk.FromColumn, fk.To, fk.ToColumn), Class: "check-foreign-keys", Duration: time.Since(started)}
 				if count > 0 {
 					fmt.Fprintf(os.Stdout, "table `%s`.`%s` references `%s`.`%s`, but `%s` is missing %d values\n", fk.From, fk.FromColumn, fk.To, fk.ToColumn, fk.To, count)
-					q := fmt.Sprintf("SELECT * FROM `%s` WHERE `%s` NOT IN (SELECT `%s` FROM `%s`)", fk.From, fk.FromColumn, fk.ToColumn, fk.To)
-					fmt.Fprintf(os.Stdout, "use this query to find the missing values:\n  %s\n", q)
+					fmt.Fprintf(os.Stdout, "use this query to find the missing values:\n  %s\n", orphans)
+					c.Failure = fmt.Sprintf("`%s` is missing %d values", fk.To, count)
+					c.Details = orphans
+					found.add("orphans", int64(count))
+				}
+				if junit != nil {
+					junit.Add(c)
 				}
 			}
 		}
 
-		return nil
+		return found.exit()
 	},
 }
+
+// orphanQueries returns the query that counts the values of a foreign key
+// column that are missing from the referenced table, and the query that finds
+// the rows which hold them, quoted for the dialect.
+func orphanQueries(d dialect.Dialect, fk schema.ForeignKey) (count, rows string) {
+	missing := fmt.Sprintf("FROM %s WHERE %s NOT IN (SELECT %s FROM %s)", d.QuoteIdent(fk.From), d.QuoteIdent(fk.FromColumn), d.QuoteIdent(fk.ToColumn), d.QuoteIdent(fk.To))
+	return fmt.Sprintf("SELECT COUNT(DISTINCT %s) %s", d.QuoteIdent(fk.FromColumn), missing), "SELECT * " + missing
+}
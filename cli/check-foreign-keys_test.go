@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+
+	"sqlcmp/datasource"
+	"sqlcmp/datasource/dialect"
+	"sqlcmp/datasource/schema"
+	_ "sqlcmp/datasource/sqlite"
+)
+
+func TestOrphanQueries(t *testing.T) {
+	fk := schema.ForeignKey{Name: "orders_user", From: "orders", FromColumn: "user_id", To: "users", ToColumn: "id"}
+	d, err := dialect.Get("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, _ := orphanQueries(d, fk)
+	if expected := `SELECT COUNT(DISTINCT "user_id") FROM "orders" WHERE "user_id" NOT IN (SELECT "id" FROM "users")`; count != expected {
+		t.Errorf("unexpected query:\n%s\nexpected:\n%s", count, expected)
+	}
+
+	source, err := datasource.OpenDSN("sqlite3://" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	if _, err = source.DB().Exec("CREATE TABLE users (id INTEGER PRIMARY KEY); CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER); INSERT INTO users VALUES (1); INSERT INTO orders VALUES (1, 1), (2, 2), (3, 2)"); err != nil {
+		t.Fatal(err)
+	}
+	if d, err = dialect.Get("sqlite3"); err != nil {
+		t.Fatal(err)
+	}
+	count, rows := orphanQueries(d, fk)
+	var missing, orphans int
+	if err = source.DB().QueryRow(count).Scan(&missing); err != nil || missing != 1 {
+		t.Errorf("expected 1 missing value, got %d, %v", missing, err)
+	}
+	if err = source.DB().QueryRow("SELECT COUNT(*) FROM (" + rows + ")").Scan(&orphans); err != nil || orphans != 2 {
+		t.Errorf("expected 2 orphaned rows, got %d, %v", orphans, err)
+	}
+}
@@ -1,140 +1,707 @@
 package cli
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"sort"
+	"sqlcmp/compare"
+	"sqlcmp/config"
 	"sqlcmp/datasource"
+	"sqlcmp/datasource/dialect"
 	"sqlcmp/datasource/dsn"
+	"sqlcmp/datasource/schema"
+	"sqlcmp/patch"
+	"sqlcmp/report"
+	"sqlcmp/throttle"
+	"strings"
+	"time"
 
 	"github.com/urfave/cli/v2"
 	"github.com/wyattis/z/zset/zstringset"
 )
 
+var diffFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "patch-out",
+		Usage: "Write the INSERT, UPDATE and DELETE statements that make the to-dsn match the from-dsn to this file",
+	},
+	&cli.IntFlag{
+		Name:  "patch-batch-size",
+		Usage: "Number of rows per INSERT or DELETE statement in the patch",
+		Value: 100,
+	},
+	&cli.IntFlag{
+		Name:  "parallel",
+		Usage: "Number of tables to compare at once, which is also the number of connections to each source",
+		Value: 1,
+	},
+	&cli.StringFlag{
+		Name:  "format",
+		Usage: "Format of the report written to stdout (text, json, ndjson)",
+		Value: "text",
+	},
+	&cli.StringFlag{
+		Name:  "report",
+		Usage: "Also write a self-contained HTML report to this file",
+	},
+	&cli.IntFlag{
+		Name:  "report-max-rows",
+		Usage: "Number of differing rows of each table shown in the HTML report, 0 shows all of them",
+		Value: 1000,
+	},
+	snapshotFlag,
+	junitFlag,
+	failOnFlag(diffCategories...),
+}
+
+// diffCategories are the findings of diff
+var diffCategories = []string{"tables", "columns", "only-in-from", "only-in-to", "changed"}
+
+// compareFlags control how values are compared by every command that compares
+// data.
+var compareFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "from-timezone",
+		Usage: "Time zone of from-dsn date times that don't include an offset",
+		Value: "UTC",
+	},
+	&cli.StringFlag{
+		Name:  "to-timezone",
+		Usage: "Time zone of to-dsn date times that don't include an offset",
+		Value: "UTC",
+	},
+	&cli.BoolFlag{
+		Name:  "null-equals-empty",
+		Usage: "Treat NULL and empty strings as equal",
+	},
+	newGenericFlag("key", "Columns that identify the rows of a table without a primary key, as table=col1,col2", func() cli.Generic { return tableKeys{} }),
+	&cli.StringFlag{
+		Name:  "mode",
+		Usage: "How tables are compared (rows, checksum). checksum hashes ranges of rows on the server and only reads the ranges that differ",
+		Value: "rows",
+	},
+	&cli.IntFlag{
+		Name:  "chunk-size",
+		Usage: "Number of rows hashed at once in checksum mode, or read at once while reads are throttled",
+		Value: 10000,
+	},
+	&cli.IntFlag{
+		Name:  "chunk-min-rows",
+		Usage: "Number of rows below which a mismatching chunk is compared row by row in checksum mode",
+		Value: 1000,
+	},
+}
+
+// comparison holds the settings shared by every table that is compared.
+type comparison struct {
+	from, to datasource.DataSource
+	// fromDriver and toDriver are the drivers of the sources, as checksums
+	// only match sources of the same driver
+	fromDriver, toDriver string
+	options              compare.Options
+	// keys overrides the key of tables
+	keys tableKeys
+	// rules holds the ignored columns and tolerances of tables
+	rules map[string]config.Table
+	// renames maps tables and columns to their names in to, which is read
+	// under the from names
+	renames datasource.Renames
+	// checksum hashes chunks of each table on the server when it's set
+	checksum *compare.ChecksumOptions
+	// chunkSize is the number of rows read at once while the reads are
+	// throttled
+	chunkSize int
+	// fromThrottle and toThrottle slow down the reads of the sources
+	fromThrottle, toThrottle *throttle.Throttle
+}
+
+func newComparison(cCtx *cli.Context, sources SourceConfig, fromDb, toDb datasource.DataSource) (c *comparison, err error) {
+	c = &comparison{from: fromDb, to: toDb, keys: tableKeys{}, rules: sources.Rules, renames: sources.Renames}
+	if c.fromDriver, err = sourceDriver(sources.FromDSN); err != nil {
+		return
+	}
+	if c.toDriver, err = sourceDriver(sources.ToDSN); err != nil {
+		return
+	}
+	for table, rule := range sources.Rules {
+		if rule.Key != nil {
+			c.keys[table] = rule.Key
+		}
+	}
+	// --key wins over the config file
+	if keys, ok := cCtx.Generic("key").(tableKeys); ok {
+		for table, key := range keys {
+			c.keys[table] = key
+		}
+	}
+	if c.options.FromLocation, err = time.LoadLocation(cCtx.String("from-timezone")); err != nil {
+		return nil, fmt.Errorf("invalid from-timezone:\n%w", err)
+	}
+	if c.options.ToLocation, err = time.LoadLocation(cCtx.String("to-timezone")); err != nil {
+		return nil, fmt.Errorf("invalid to-timezone:\n%w", err)
+	}
+	c.options.NullEqualsEmpty = cCtx.Bool("null-equals-empty")
+	c.chunkSize = cCtx.Int("chunk-size")
+	switch mode := cCtx.String("mode"); mode {
+	case "rows":
+	case "checksum":
+		c.checksum = &compare.ChecksumOptions{ChunkSize: cCtx.Int("chunk-size"), RowThreshold: cCtx.Int("chunk-min-rows")}
+	default:
+		return nil, fmt.Errorf("unknown mode: %s", mode)
+	}
+	if c.fromThrottle, c.toThrottle, err = newThrottles(cCtx, fromDb, toDb); err != nil {
+		return nil, err
+	}
+	return
+}
+
 var diffCmd = &cli.Command{
-	Name:  "diff",
-	Usage: "compare the data in two data sources",
-	Flags: sharedFlags,
+	Name:      "diff",
+	ArgsUsage: "[from] [to]",
+	Usage:     "compare the data in two data sources",
+	Flags:     append(append(append(append(diffFlags, compareFlags...), renameFlags...), throttleFlags...), sharedFlags...),
 	Action: func(cCtx *cli.Context) (err error) {
-		sources := flagsToSources(cCtx)
+		sources, err := loadSources(cCtx)
+		if err != nil {
+			return err
+		}
 		if sources.FromDSN == "" || sources.ToDSN == "" {
 			return fmt.Errorf("from-dsn and to-dsn are required")
 		}
-		fromCfg, err := dsn.Parse(sources.FromDSN)
+		fromDb, err := openSource(cCtx.Context, sources.FromDSN, sources.FromPassword, sources.PromptForPassword, "Enter 'from-dsn' password: ")
 		if err != nil {
 			return err
 		}
-		toCfg, err := dsn.Parse(sources.ToDSN)
+		defer fromDb.Close()
+		toDb, err := openSource(cCtx.Context, sources.ToDSN, sources.ToPassword, sources.PromptForPassword, "Enter 'to-dsn' password: ")
 		if err != nil {
 			return err
 		}
-		if sources.PromptForPassword {
-			if err = ensurePassword(&fromCfg, "Enter 'from-dsn' password: "); err != nil {
-				return
-			}
-			if err = ensurePassword(&toCfg, "Enter 'to-dsn' password: "); err != nil {
-				return
-			}
+		defer toDb.Close()
+		ctx, cancel := commandContext(cCtx)
+		defer cancel()
+		defer func() { err = contextError(ctx, err) }()
+		snapshots, err := startSnapshots(ctx, cCtx, fromDb, toDb)
+		if err != nil {
+			return err
 		}
-		toDb, err := datasource.Open(toCfg)
+		// tables and columns of to are compared under their from names
+		toDb = datasource.Renamed(toDb, sources.Renames)
+		comparison, err := newComparison(cCtx, sources, fromDb, toDb)
 		if err != nil {
 			return err
 		}
-		defer toDb.Close()
-		fromDb, err := datasource.Open(fromCfg)
+		found, err := newFindings(cCtx, diffCategories...)
 		if err != nil {
 			return err
 		}
-		defer fromDb.Close()
+		var format report.Format
+		switch name := cCtx.String("format"); name {
+		case "text":
+			format = report.NewText(os.Stdout)
+		case "json":
+			json := report.NewJSON(os.Stdout)
+			json.Snapshots = snapshots
+			format = json
+		case "ndjson":
+			ndjson := report.NewNDJSON(os.Stdout)
+			ndjson.Snapshots = snapshots
+			format = ndjson
+		default:
+			return fmt.Errorf("unknown format: %s", name)
+		}
 
-		fmt.Fprintf(os.Stderr, "comparing data between %s and %s\n", sources.FromDSN, sources.ToDSN)
-		toTables, err := toDb.GetTableNames()
+		junit, finishJUnit, err := junitFile(cCtx, "diff")
 		if err != nil {
 			return err
 		}
-		fromTables, err := fromDb.GetTableNames()
+		defer func() {
+			if endErr := finishJUnit(contextError(ctx, err)); err == nil {
+				err = endErr
+			}
+		}()
+
+		var html *report.HTML
+		if path := cCtx.String("report"); path != "" {
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			html = report.NewHTML(f, report.Run{
+				From:          dsn.Redact(sources.FromDSN),
+				To:            dsn.Redact(sources.ToDSN),
+				Started:       time.Now(),
+				Mode:          cCtx.String("mode"),
+				IncludeTables: sources.Tables,
+				ExcludeTables: sources.ExcludeTables,
+				Snapshots:     snapshots,
+			}, cCtx.Int("report-max-rows"))
+			// runs before contextError explains err, so it's explained here too
+			defer func() {
+				if endErr := html.End(contextError(ctx, failure(err))); err == nil {
+					err = endErr
+				}
+			}()
+		}
+
+		var patchOut *patchFile
+		if path := cCtx.String("patch-out"); path != "" {
+			d, err := targetDialect("", sources.ToDSN)
+			if err != nil {
+				return err
+			}
+			f, err := os.Create(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			patchOut = &patchFile{w: f, dialect: d, batchSize: cCtx.Int("patch-batch-size")}
+		}
+
+		parallel := cCtx.Int("parallel")
+		if parallel > 1 {
+			conns := parallel
+			if cCtx.String("load-query") != "" {
+				// the load check needs a connection of its own
+				conns++
+			}
+			fromDb.DB().SetMaxOpenConns(conns)
+			toDb.DB().SetMaxOpenConns(conns)
+		}
+
+		fmt.Fprintf(os.Stderr, "comparing data between %s and %s\n", dsn.Redact(sources.FromDSN), dsn.Redact(sources.ToDSN))
+		sharedTables, missingTables, extraTables, err := matchTables(ctx, fromDb, toDb, sources)
 		if err != nil {
 			return err
 		}
-
-		toTableSet, fromTableSet := zstringset.New(toTables...), zstringset.New(fromTables...)
-		missingTables := fromTableSet.Clone().Difference(toTableSet)
-		for _, table := range missingTables.Items() {
+		for _, table := range missingTables {
 			fmt.Fprintf(os.Stderr, "missing table: %s\n", table)
 		}
-		sharedTables := fromTableSet.Clone().Intersection(toTableSet)
-		for _, table := range sharedTables.Items() {
-			fmt.Fprintf(os.Stderr, "comparing table: %s\n", table)
-			if err = compareTable(fromDb, toDb, table); err != nil {
+		found.add("tables", int64(len(missingTables)+len(extraTables)))
+		if err = format.Begin(missingTables, extraTables); err != nil {
+			return err
+		}
+		if html != nil {
+			if err = html.Begin(missingTables, extraTables); err != nil {
 				return err
 			}
 		}
-		return
+		if junit != nil {
+			if err = junit.Begin(missingTables, extraTables); err != nil {
+				return err
+			}
+		}
+		var patchW io.Writer = io.Discard
+		if patchOut != nil {
+			patchW = patchOut.w
+		}
+		err = forEachTable(ctx, sharedTables, parallel, format.Output(), patchW, func(ctx context.Context, table string, stdout, patch io.Writer) (err error) {
+			fmt.Fprintf(os.Stderr, "comparing table: %s\n", table)
+			writers := []report.TableWriter{format.Table(stdout)}
+			if html != nil {
+				writers = append(writers, html.Table())
+			}
+			if junit != nil {
+				writers = append(writers, junit.Table())
+			}
+			printer := &diffPrinter{out: report.Multi(writers...), found: found}
+			if patchOut != nil {
+				printer.patchOut = &patchFile{w: patch, dialect: patchOut.dialect, batchSize: patchOut.batchSize}
+			}
+			_, err = comparison.table(ctx, table, printer)
+			return
+		})
+		if endErr := format.End(contextError(ctx, err)); err == nil {
+			err = endErr
+		}
+		if err != nil {
+			return err
+		}
+		return found.exit()
 	},
 }
 
-func compareTable(fromDb, toDb datasource.DataSource, table string) (err error) {
-	from, err := fromDb.GetSchema([]string{table})
+// tableInfo describes a table that is about to be compared.
+type tableInfo struct {
+	compare.Table
+	// OnlyInFromColumns and OnlyInToColumns exist on one side only and aren't
+	// compared
+	OnlyInFromColumns, OnlyInToColumns []string
+	// Target is the table under its names in to, which patches change
+	Target compare.Table
+	// UniqueKey tells whether to has a unique index on exactly the key, which
+	// upserts need
+	UniqueKey bool
+}
+
+// tableHandler receives the differences of a table as they are found. Done is
+// called once Start succeeded, with the error that stopped the comparison if
+// there was one.
+type tableHandler interface {
+	Start(table tableInfo) error
+	Difference(d compare.Difference) error
+	Done(counts compare.Counts, err error) error
+}
+
+// diffPrinter reports the differences of a table and adds them to the patch.
+type diffPrinter struct {
+	out      report.TableWriter
+	patchOut *patchFile
+	found    *findings
+	table    compare.Table
+	builder  *patch.Builder
+}
+
+func (p *diffPrinter) Start(table tableInfo) (err error) {
+	p.table = table.Table
+	p.found.add("columns", int64(len(table.OnlyInFromColumns)+len(table.OnlyInToColumns)))
+	if p.patchOut != nil {
+		if p.builder, err = p.patchOut.builder(table.Target, table.UniqueKey); err != nil {
+			return
+		}
+	}
+	key := make([]string, len(table.Key))
+	for i, k := range table.Key {
+		key[i] = table.Columns[k]
+	}
+	return p.out.Start(report.Table{Name: table.Name, Key: key, OnlyInFromColumns: table.OnlyInFromColumns, OnlyInToColumns: table.OnlyInToColumns})
+}
+
+func (p *diffPrinter) Difference(d compare.Difference) (err error) {
+	if p.builder != nil {
+		if err = p.builder.Add(d); err != nil {
+			return
+		}
+	}
+	return p.out.Difference(report.NewDifference(p.table, d))
+}
+
+func (p *diffPrinter) Done(counts compare.Counts, failure error) (err error) {
+	p.found.add("only-in-from", counts.OnlyInFrom)
+	p.found.add("only-in-to", counts.OnlyInTo)
+	p.found.add("changed", counts.Changed)
+	if p.builder != nil && failure == nil {
+		if err = p.builder.Flush(); err != nil {
+			return
+		}
+	}
+	return p.out.Done(counts, failure)
+}
+
+// patchFile is where diff writes the statements that reconcile the tables.
+type patchFile struct {
+	w         io.Writer
+	dialect   dialect.Dialect
+	batchSize int
+}
+
+// builder returns a patch builder for the table which writes a comment before
+// the first statement of the table. Tables without a key can't be patched
+// reliably so it only writes a comment for them and returns nil.
+func (p *patchFile) builder(table compare.Table, uniqueKey bool) (b *patch.Builder, err error) {
+	if len(table.Key) == 0 {
+		_, err = fmt.Fprintf(p.w, "-- table %s has no key and isn't patched\n", table.Name)
+		return
+	}
+	started := false
+	return patch.NewBuilder(p.dialect, table, uniqueKey, p.batchSize, func(kind compare.Kind, stmts ...string) (err error) {
+		if !started {
+			started = true
+			if _, err = fmt.Fprintf(p.w, "-- table %s\n", table.Name); err != nil {
+				return
+			}
+		}
+		for _, stmt := range stmts {
+			if _, err = fmt.Fprintf(p.w, "%s;\n", stmt); err != nil {
+				return
+			}
+		}
+		return
+	}), nil
+}
+
+// matchTables returns the tables that exist in both sources, the tables that are
+// missing from `to` and the tables that only exist in `to`, after applying the
+// table filters.
+func matchTables(ctx context.Context, fromDb, toDb datasource.DataSource, sources SourceConfig) (shared, missing, extra []string, err error) {
+	toTables, err := toDb.GetTableNamesContext(ctx)
 	if err != nil {
-		return err
+		return
 	}
-	to, err := toDb.GetSchema([]string{table})
+	fromTables, err := fromDb.GetTableNamesContext(ctx)
 	if err != nil {
-		return err
+		return
+	}
+	toTables = filterTables(toTables, sources.Tables, sources.ExcludeTables)
+	fromTables = filterTables(fromTables, sources.Tables, sources.ExcludeTables)
+
+	toTableSet, fromTableSet := zstringset.New(toTables...), zstringset.New(fromTables...)
+	missing = fromTableSet.Clone().Difference(toTableSet).Items()
+	extra = toTableSet.Clone().Difference(fromTableSet).Items()
+	shared = fromTableSet.Clone().Intersection(toTableSet).Items()
+	sort.Strings(missing)
+	sort.Strings(extra)
+	sort.Strings(shared)
+	return
+}
+
+// table compares the rows of a table that exists in both sources.
+func (c *comparison) table(ctx context.Context, table string, handler tableHandler) (counts compare.Counts, err error) {
+	from, err := c.from.GetSchemaContext(ctx, []string{table})
+	if err != nil {
+		return
+	}
+	to, err := c.to.GetSchemaContext(ctx, []string{table})
+	if err != nil {
+		return
 	}
 	fromTable, toTable := from[0], to[0]
-	fromPk, fromCols := []string{}, []string{}
-	for _, col := range fromTable.Columns {
-		fromCols = append(fromCols, col.Name)
-		if col.IsPrimary {
-			fromPk = append(fromPk, col.Name)
+	rule := c.rules[table]
+	keyCols, description, err := chooseKey(fromTable, toTable, c.keys[table])
+	if err != nil {
+		return
+	}
+	for _, col := range keyCols {
+		if indexOf(rule.IgnoreColumns, col) >= 0 {
+			return counts, fmt.Errorf("key column %s of table %s can't be ignored", col, table)
 		}
 	}
-	if len(fromPk) == 0 {
-		return fmt.Errorf("table %s has no primary key", fromTable.Name)
+	if keyCols == nil {
+		fmt.Fprintf(os.Stderr, "table %s has no key, comparing it as a multiset of rows\n", table)
+	} else if description != "primary key" {
+		fmt.Fprintf(os.Stderr, "comparing table %s by %s\n", table, description)
+	}
+
+	fromCols, toCols := []string{}, []string{}
+	for _, col := range fromTable.Columns {
+		if indexOf(rule.IgnoreColumns, col.Name) < 0 {
+			fromCols = append(fromCols, col.Name)
+		}
 	}
-	toPk, toCols := []string{}, []string{}
 	for _, col := range toTable.Columns {
-		toCols = append(toCols, col.Name)
-		if col.IsPrimary {
-			toPk = append(toPk, col.Name)
+		if indexOf(rule.IgnoreColumns, col.Name) < 0 {
+			toCols = append(toCols, col.Name)
 		}
 	}
-	if len(toPk) == 0 {
-		return fmt.Errorf("table %s has no primary key", toTable.Name)
+	sharedCols, fromKinds, toKinds := []string{}, []schema.Kind{}, []schema.Kind{}
+	for _, col := range fromTable.Columns {
+		if indexOf(fromCols, col.Name) < 0 || indexOf(toCols, col.Name) < 0 {
+			continue
+		}
+		for _, toCol := range toTable.Columns {
+			if toCol.Name == col.Name {
+				sharedCols = append(sharedCols, col.Name)
+				fromKinds = append(fromKinds, col.Kind())
+				toKinds = append(toKinds, toCol.Kind())
+			}
+		}
 	}
-	if len(fromPk) != len(toPk) {
-		return fmt.Errorf("table %s has different primary key columns", table)
+	key := make([]int, len(keyCols))
+	for i, col := range keyCols {
+		key[i] = indexOf(sharedCols, col)
+	}
+	var tolerances []compare.Tolerance
+	if len(rule.Tolerances) > 0 {
+		tolerances = make([]compare.Tolerance, len(sharedCols))
+		for col, tolerance := range rule.Tolerances {
+			i := indexOf(sharedCols, col)
+			if i < 0 {
+				return counts, fmt.Errorf("tolerance column %s of table %s isn't compared", col, table)
+			}
+			tolerances[i] = tolerance.Tolerance
+		}
+	}
+
+	info := tableInfo{
+		Table:             compare.Table{Name: table, Columns: sharedCols, Key: key, FromKinds: fromKinds, ToKinds: toKinds, Options: c.options, Tolerances: tolerances},
+		OnlyInFromColumns: onlyIn(fromCols, toCols),
+		OnlyInToColumns:   onlyIn(toCols, fromCols),
+		UniqueKey:         hasUniqueIndex(toTable, keyCols),
+	}
+	info.Target = info.Table
+	info.Target.Name, info.Target.Columns = c.renames.Table(table), c.renames.ColumnNames(table, sharedCols)
+	if info.Target.Name != table {
+		fmt.Fprintf(os.Stderr, "table %s is compared with %s in 'to'\n", table, info.Target.Name)
+	}
+	if len(info.OnlyInFromColumns) > 0 {
+		fmt.Fprintf(os.Stderr, "table %s: 'to' is missing columns: %s\n", table, strings.Join(info.OnlyInFromColumns, ", "))
+	}
+	if len(info.OnlyInToColumns) > 0 {
+		fmt.Fprintf(os.Stderr, "table %s: 'from' is missing columns: %s\n", table, strings.Join(info.OnlyInToColumns, ", "))
 	}
 
-	sharedCols := zstringset.New(fromCols...).Intersection(zstringset.New(toCols...)).Items()
+	if err = handler.Start(info); err != nil {
+		return
+	}
+	nullable := false
+	for _, col := range keyCols {
+		nullable = nullable || isNullable(fromTable, col) || isNullable(toTable, col)
+	}
+	counts, err = c.rows(ctx, info.Table, nullable, func(d compare.Difference) error {
+		// stop early when another table failed
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return handler.Difference(d)
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to compare table %s: %w", table, err)
+	}
+	if doneErr := handler.Done(counts, err); err == nil {
+		err = doneErr
+	}
+	return
+}
 
-	fromIter, err := fromDb.TableIterator(table, sharedCols, fromPk)
+// rows compares the rows of a table. nullable tells whether its key can be NULL,
+// which rules out comparing it by checksums.
+func (c *comparison) rows(ctx context.Context, spec compare.Table, nullable bool, fn func(compare.Difference) error) (counts compare.Counts, err error) {
+	key := make([]string, len(spec.Key))
+	for i, k := range spec.Key {
+		key[i] = spec.Columns[k]
+	}
+	throttled := c.fromThrottle != nil || c.toThrottle != nil
+	if len(key) == 0 {
+		if throttled {
+			fmt.Fprintf(os.Stderr, "reads of table %s pause within one query\n", spec.Name)
+		}
+		if spec.Options.NullEqualsEmpty {
+			fmt.Fprintf(os.Stderr, "table %s has no key, so NULL and empty strings are compared as different\n", spec.Name)
+		}
+		// sorting by every column brings equal rows together
+		fromIter, err := c.from.TableIteratorContext(ctx, spec.Name, spec.Columns, spec.Columns)
+		if err != nil {
+			return counts, err
+		}
+		defer fromIter.Close()
+		toIter, err := c.to.TableIteratorContext(ctx, spec.Name, spec.Columns, spec.Columns)
+		if err != nil {
+			return counts, err
+		}
+		defer toIter.Close()
+		return compare.Multiset(c.fromThrottle.Iterator(ctx, fromIter), c.toThrottle.Iterator(ctx, toIter), spec, fn)
+	}
+	if c.checksum != nil || throttled {
+		fromSummer, toSummer, reason, err := c.checksummers(ctx, spec.Name, key, nullable)
+		if err != nil {
+			return counts, err
+		}
+		switch {
+		case reason != "":
+			fmt.Fprintf(os.Stderr, "%s, reading every row of %s in one query\n", reason, spec.Name)
+		case c.checksum != nil:
+			return compare.Checksum(ctx, c.fromThrottle.Checksummer(fromSummer), c.toThrottle.Checksummer(toSummer), spec, *c.checksum, fn)
+		default:
+			// the throttles sleep between the ranges, so no query is open while
+			// they do
+			return compare.Ranges(ctx, c.fromThrottle.Checksummer(fromSummer), c.toThrottle.Checksummer(toSummer), spec, c.chunkSize, fn)
+		}
+	}
+	fromIter, err := c.from.TableIteratorContext(ctx, spec.Name, spec.Columns, key)
 	if err != nil {
-		return err
+		return
 	}
 	defer fromIter.Close()
-	toIter, err := toDb.TableIterator(table, sharedCols, fromPk)
+	toIter, err := c.to.TableIteratorContext(ctx, spec.Name, spec.Columns, key)
 	if err != nil {
-		return err
+		return
 	}
 	defer toIter.Close()
+	return compare.Rows(c.fromThrottle.Iterator(ctx, fromIter), c.toThrottle.Iterator(ctx, toIter), spec, fn)
+}
+
+// checksummers returns both sources as Checksummers if the table can be read in
+// ranges of its key, or the reason why it can't.
+func (c *comparison) checksummers(ctx context.Context, table string, key []string, nullable bool) (from, to datasource.Checksummer, reason string, err error) {
+	from, fromOk := c.from.(datasource.Checksummer)
+	to, toOk := c.to.(datasource.Checksummer)
+	if !fromOk || !toOk {
+		return nil, nil, "key ranges aren't supported by both sources", nil
+	}
+	if nullable {
+		return nil, nil, "the key can be NULL", nil
+	}
+	// ranges of rows are compared by their values, so only the checksums need
+	// the same driver
+	if c.checksum != nil && c.fromDriver != c.toDriver {
+		return nil, nil, fmt.Sprintf("checksums of %s and %s sources can't be compared", c.fromDriver, c.toDriver), nil
+	}
+	fromOrder, err := from.KeyOrder(ctx, table, key)
+	if err != nil {
+		return
+	}
+	toOrder, err := to.KeyOrder(ctx, table, key)
+	if err != nil {
+		return
+	}
+	if !slices.Equal(fromOrder, toOrder) {
+		return nil, nil, fmt.Sprintf("the sources sort the key differently (%q and %q)", fromOrder, toOrder), nil
+	}
+	return
+}
 
-	// TODO: fix how we represent which columns are missing from each datasource
-	if len(fromCols) != len(toCols) {
-		missingCols := zstringset.New(fromCols...).Difference(zstringset.New(toCols...)).Items()
-		fmt.Fprintln(os.Stderr, "'to' is missing columns: ", missingCols)
+// hasUniqueIndex reports whether the table has a unique index on exactly the
+// columns, in any order and without prefixes. The primary key counts even when
+// the source doesn't list it as an index, like the rowid alias of sqlite.
+func hasUniqueIndex(table schema.Table, columns []string) bool {
+	sameColumns := func(cols []string) bool {
+		return len(columns) > 0 && len(cols) == len(columns) && len(onlyIn(columns, cols)) == 0
+	}
+	primary := []string{}
+	for _, col := range table.Columns {
+		if col.IsPrimary {
+			primary = append(primary, col.Name)
+		}
+	}
+	if sameColumns(primary) {
+		return true
 	}
+	for _, idx := range table.Indices {
+		prefixed := slices.ContainsFunc(idx.Lengths, func(l int) bool { return l > 0 })
+		if (idx.Unique || idx.Primary) && !prefixed && sameColumns(idx.Columns) {
+			return true
+		}
+	}
+	return false
+}
 
-	// TODO: Probably we need to compare the actual underlying data types here instead of just the bytes
-	fromRow, toRow := make([]interface{}, len(sharedCols)), make([]interface{}, len(sharedCols))
-	for i := range fromRow {
-		fromRow[i] = new([]byte)
+// sourceDriver returns the driver of the dsn under one name for all its aliases.
+func sourceDriver(rawDsn string) (string, error) {
+	driver, err := targetDriver("", rawDsn)
+	if driver == "postgresql" {
+		driver = "postgres"
 	}
-	for i := range toRow {
-		toRow[i] = new([]byte)
+	return driver, err
+}
+
+func isNullable(table schema.Table, column string) bool {
+	for _, col := range table.Columns {
+		if col.Name == column {
+			return col.IsNullable
+		}
 	}
+	return false
+}
 
-	// TODO: do the comparison
+func indexOf(items []string, item string) int {
+	for i, v := range items {
+		if v == item {
+			return i
+		}
+	}
+	return -1
+}
 
+// onlyIn returns the items of a that aren't in b, in the order of a.
+func onlyIn(a, b []string) (items []string) {
+	for _, item := range a {
+		if indexOf(b, item) < 0 {
+			items = append(items, item)
+		}
+	}
 	return
 }
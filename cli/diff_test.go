@@ -0,0 +1,60 @@
+package cli
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sqlcmp/compare"
+	"sqlcmp/datasource"
+	"sqlcmp/datasource/schema"
+	_ "sqlcmp/datasource/sqlite"
+)
+
+func TestChecksummersDrivers(t *testing.T) {
+	source, err := datasource.OpenDSN("sqlite3://" + filepath.Join(t.TempDir(), "t.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	if _, err = source.DB().Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		checksum         *compare.ChecksumOptions
+		toDriver, reason string
+	}{
+		{&compare.ChecksumOptions{ChunkSize: 10}, "sqlite3", ""},
+		{&compare.ChecksumOptions{ChunkSize: 10}, "mysql", "checksums of sqlite3 and mysql sources can't be compared"},
+		// ranges read without checksums compare the rows themselves
+		{nil, "mysql", ""},
+	}
+	for _, tc := range cases {
+		c := &comparison{from: source, to: source, fromDriver: "sqlite3", toDriver: tc.toDriver, checksum: tc.checksum}
+		from, to, reason, err := c.checksummers(context.Background(), "t", []string{"id"}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason != tc.reason || (reason == "") != (from != nil && to != nil) {
+			t.Errorf("to %s with checksums %v: unexpected reason %q", tc.toDriver, tc.checksum != nil, reason)
+		}
+	}
+}
+
+func TestHasUniqueIndex(t *testing.T) {
+	table := schema.Table{
+		Columns: []schema.Column{{Name: "id", IsPrimary: true}, {Name: "a"}, {Name: "b"}, {Name: "name"}},
+		Indices: []schema.Index{
+			{Name: "ab", Unique: true, Columns: []string{"a", "b"}},
+			{Name: "name_prefix", Unique: true, Columns: []string{"name"}, Lengths: []int{10}},
+			{Name: "a_idx", Columns: []string{"a"}},
+		},
+	}
+	cases := map[string]bool{"id": true, "b,a": true, "a": false, "name": false, "id,a": false}
+	for key, unique := range cases {
+		if hasUniqueIndex(table, strings.Split(key, ",")) != unique {
+			t.Errorf("key %s: expected unique %v", key, unique)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli/v2"
+)
+
+// Exit codes shared by every command
+const (
+	// ExitFindings is used when a command found differences or violations in
+	// one of the --fail-on categories
+	ExitFindings = 1
+	// ExitError is used for invalid usage, connection errors and any other
+	// error that stopped a command
+	ExitError = 2
+)
+
+// failOnFlag selects which of the categories of a command fail it.
+func failOnFlag(categories ...string) *cli.StringSliceFlag {
+	return &cli.StringSliceFlag{
+		Name:  "fail-on",
+		Usage: fmt.Sprintf("Finding categories that make the command exit with %d (%s, all, none)", ExitFindings, strings.Join(categories, ", ")),
+		Value: cli.NewStringSlice("all"),
+	}
+}
+
+// findings counts what a command found by category.
+type findings struct {
+	categories []string
+	failOn     map[string]bool
+
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// newFindings checks the --fail-on flag of a command with these categories.
+func newFindings(cCtx *cli.Context, categories ...string) (f *findings, err error) {
+	f = &findings{categories: categories, failOn: map[string]bool{}, counts: map[string]int64{}}
+	for _, value := range cCtx.StringSlice("fail-on") {
+		for _, category := range strings.Split(value, ",") {
+			switch category = strings.TrimSpace(category); category {
+			case "all":
+				for _, c := range categories {
+					f.failOn[c] = true
+				}
+			case "none":
+			default:
+				if indexOf(categories, category) < 0 {
+					return nil, fmt.Errorf("unknown fail-on category: %s", category)
+				}
+				f.failOn[category] = true
+			}
+		}
+	}
+	return
+}
+
+// add is safe to call from several goroutines.
+func (f *findings) add(category string, n int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.counts[category] += n
+}
+
+// exit returns an error with ExitFindings when something was found in one of
+// the categories of --fail-on.
+func (f *findings) exit() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	found := []string{}
+	for _, category := range f.categories {
+		if f.failOn[category] && f.counts[category] > 0 {
+			found = append(found, fmt.Sprintf("%d %s", f.counts[category], category))
+		}
+	}
+	if len(found) == 0 {
+		return nil
+	}
+	return cli.Exit("found "+strings.Join(found, ", "), ExitFindings)
+}
+
+// failure returns the error that stopped a command, or nil when err only
+// reports the findings through the exit code.
+func failure(err error) error {
+	var exit cli.ExitCoder
+	if errors.As(err, &exit) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func findingsContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := failOnFlag(diffCategories...).Apply(set); err != nil {
+		t.Fatal(err)
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cli.NewContext(nil, set, nil)
+}
+
+func TestFindings(t *testing.T) {
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "found 1 columns, 2 changed"},
+		{[]string{"--fail-on", "changed"}, "found 2 changed"},
+		{[]string{"--fail-on", "tables,only-in-to"}, ""},
+		{[]string{"--fail-on", "none"}, ""},
+	}
+	for _, c := range cases {
+		found, err := newFindings(findingsContext(t, c.args...), diffCategories...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found.add("changed", 2)
+		found.add("columns", 1)
+		found.add("only-in-to", 0)
+		err = found.exit()
+		if c.expected == "" {
+			if err != nil {
+				t.Errorf("%v: expected no error, got %v", c.args, err)
+			}
+			continue
+		}
+		exit, ok := err.(cli.ExitCoder)
+		if !ok || exit.ExitCode() != ExitFindings || err.Error() != c.expected {
+			t.Errorf("%v: expected %q with exit code %d, got %v", c.args, c.expected, ExitFindings, err)
+		}
+	}
+	if _, err := newFindings(findingsContext(t, "--fail-on", "rows"), diffCategories...); err == nil {
+		t.Error("expected an unknown category to fail")
+	}
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"os"
+
+	"sqlcmp/report"
+
+	"github.com/urfave/cli/v2"
+)
+
+var junitFlag = &cli.StringFlag{
+	Name:  "junit",
+	Usage: "Also write the results as a JUnit XML test suite to this file",
+}
+
+// junitFile creates the --junit file of a command. finish writes the test suite
+// with the error of the command and closes the file, errors that only set the
+// exit code aren't recorded since the test cases already hold the findings.
+// junit is nil and finish does nothing when the flag isn't set.
+func junitFile(cCtx *cli.Context, suite string) (junit *report.JUnit, finish func(err error) error, err error) {
+	path := cCtx.String("junit")
+	if path == "" {
+		return nil, func(error) error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	junit = report.NewJUnit(f, suite)
+	return junit, func(err error) error {
+		endErr := junit.End(failure(err))
+		if closeErr := f.Close(); endErr == nil {
+			endErr = closeErr
+		}
+		return endErr
+	}, nil
+}
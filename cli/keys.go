@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"sqlcmp/datasource/schema"
+
+	"github.com/urfave/cli/v2"
+)
+
+// genericFlag is a GenericFlag whose value is allocated by newValue every time
+// it's applied, so the values parsed by one run of the app don't carry over to
+// the next one.
+type genericFlag struct {
+	*cli.GenericFlag
+	newValue func() cli.Generic
+}
+
+func newGenericFlag(name, usage string, newValue func() cli.Generic) cli.Flag {
+	return &genericFlag{GenericFlag: &cli.GenericFlag{Name: name, Usage: usage, Value: newValue()}, newValue: newValue}
+}
+
+func (f *genericFlag) Apply(set *flag.FlagSet) error {
+	run := *f.GenericFlag
+	run.Value = f.newValue()
+	return run.Apply(set)
+}
+
+// tableKeys is the value of the --key flag, which sets the columns that
+// identify the rows of a table.
+type tableKeys map[string][]string
+
+func (k tableKeys) Set(value string) error {
+	table, cols, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(table) == "" || strings.TrimSpace(cols) == "" {
+		return fmt.Errorf("expected table=col1,col2 but got %s", value)
+	}
+	key := strings.Split(cols, ",")
+	for i := range key {
+		key[i] = strings.TrimSpace(key[i])
+	}
+	k[strings.TrimSpace(table)] = key
+	return nil
+}
+
+func (k tableKeys) String() string {
+	keys := make([]string, 0, len(k))
+	for table, cols := range k {
+		keys = append(keys, table+"="+strings.Join(cols, ","))
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, " ")
+}
+
+// chooseKey returns the columns that identify the rows of a table in both
+// sources. A key given with --key wins, followed by the primary key and then the
+// shortest unique index whose columns can't be NULL. It returns nil when the
+// table has no key and describes the key that was chosen.
+func chooseKey(from, to schema.Table, override []string) (key []string, description string, err error) {
+	if override != nil {
+		for _, col := range override {
+			if !hasColumn(from, col) || !hasColumn(to, col) {
+				return nil, "", fmt.Errorf("key column %s of table %s doesn't exist in both sources", col, from.Name)
+			}
+		}
+		return override, "key " + strings.Join(override, ", "), nil
+	}
+	fromPk, toPk := primaryKey(from), primaryKey(to)
+	if len(fromPk) > 0 && sameColumns(fromPk, toPk) {
+		return fromPk, "primary key", nil
+	}
+	var best *schema.Index
+	for i, index := range from.Indices {
+		if !uniqueNotNull(from, index) || (best != nil && len(index.Columns) >= len(best.Columns)) {
+			continue
+		}
+		for _, other := range to.Indices {
+			if uniqueNotNull(to, other) && sameColumns(index.Columns, other.Columns) {
+				best = &from.Indices[i]
+				break
+			}
+		}
+	}
+	if best != nil {
+		return best.Columns, "unique index " + best.Name, nil
+	}
+	return nil, "", nil
+}
+
+func primaryKey(table schema.Table) (pk []string) {
+	for _, col := range table.Columns {
+		if col.IsPrimary {
+			pk = append(pk, col.Name)
+		}
+	}
+	return
+}
+
+// uniqueNotNull reports whether the index identifies every row of the table.
+func uniqueNotNull(table schema.Table, index schema.Index) bool {
+	if !index.Unique || len(index.Columns) == 0 {
+		return false
+	}
+	for _, length := range index.Lengths {
+		if length != 0 {
+			return false
+		}
+	}
+	for _, name := range index.Columns {
+		found := false
+		for _, col := range table.Columns {
+			if col.Name == name {
+				found = !col.IsNullable
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func hasColumn(table schema.Table, name string) bool {
+	for _, col := range table.Columns {
+		if col.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func sameColumns(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, col := range a {
+		if indexOf(b, col) < 0 {
+			return false
+		}
+	}
+	return true
+}
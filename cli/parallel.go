@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// tableResult holds the output of a table compared by a worker until the
+// tables before it have been written.
+type tableResult struct {
+	done   chan struct{}
+	err    error
+	stdout bytes.Buffer
+	patch  bytes.Buffer
+}
+
+// forEachTable calls fn for every table with up to parallel tables at once.
+// When tables run in parallel their output is buffered and copied to stdout
+// and patch in the order of tables. The first error cancels ctx so no new tables
+// are started, and the output of every table that was started, including the
+// partial output of the tables that failed, is still written.
+func forEachTable(ctx context.Context, tables []string, parallel int, stdout, patch io.Writer, fn func(ctx context.Context, table string, stdout, patch io.Writer) error) (err error) {
+	if parallel <= 1 {
+		for _, table := range tables {
+			if err = fn(ctx, table, stdout, patch); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]*tableResult, len(tables))
+	for i := range results {
+		results[i] = &tableResult{done: make(chan struct{})}
+	}
+	var firstErr error
+	var once sync.Once
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := range tables {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				for ; i < len(tables); i++ {
+					results[i].err = ctx.Err()
+					close(results[i].done)
+				}
+				return
+			}
+		}
+	}()
+	for w := 0; w < parallel; w++ {
+		go func() {
+			for i := range jobs {
+				r := results[i]
+				if r.err = ctx.Err(); r.err == nil {
+					r.err = fn(ctx, tables[i], &r.stdout, &r.patch)
+				}
+				if r.err != nil {
+					fail(r.err)
+				}
+				close(r.done)
+			}
+		}()
+	}
+
+	for _, r := range results {
+		<-r.done
+		if _, err = r.stdout.WriteTo(stdout); err != nil {
+			fail(err)
+			break
+		}
+		if _, err = r.patch.WriteTo(patch); err != nil {
+			fail(err)
+			break
+		}
+	}
+	// wait for the tables that are still running so they don't outlive the sources
+	for _, r := range results {
+		<-r.done
+	}
+	return firstErr
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForEachTable(t *testing.T) {
+	tables := []string{"a", "b", "c", "d", "e", "f"}
+	var stdout, patch bytes.Buffer
+	err := forEachTable(context.Background(), tables, 3, &stdout, &patch, func(ctx context.Context, table string, stdout, patch io.Writer) error {
+		// later tables finish first
+		time.Sleep(time.Duration(len(tables)-strings.Index("abcdef", table)) * time.Millisecond)
+		fmt.Fprintf(stdout, "%s\n", table)
+		fmt.Fprintf(patch, "-- %s\n", table)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "a\nb\nc\nd\ne\nf\n" {
+		t.Errorf("expected the tables in order, got %q", stdout.String())
+	}
+	if patch.String() != "-- a\n-- b\n-- c\n-- d\n-- e\n-- f\n" {
+		t.Errorf("expected the patches in order, got %q", patch.String())
+	}
+}
+
+func TestForEachTableError(t *testing.T) {
+	failure := errors.New("failed")
+	var stdout bytes.Buffer
+	// b fails once a is running, so a is started and c isn't
+	started := make(chan struct{})
+	err := forEachTable(context.Background(), []string{"a", "b", "c", "d", "e"}, 2, &stdout, io.Discard, func(ctx context.Context, table string, stdout, patch io.Writer) error {
+		switch table {
+		case "a":
+			close(started)
+			time.Sleep(20 * time.Millisecond)
+		case "b":
+			<-started
+			fmt.Fprintf(stdout, "partial %s\n", table)
+			return failure
+		default:
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(stdout, "%s\n", table)
+		return nil
+	})
+	if err != failure {
+		t.Errorf("expected the first error, got %v", err)
+	}
+	if stdout.String() != "a\npartial b\n" {
+		t.Errorf("expected the output of the started tables, got %q", stdout.String())
+	}
+}
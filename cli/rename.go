@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"sqlcmp/config"
+	"sqlcmp/datasource"
+
+	"github.com/urfave/cli/v2"
+)
+
+// renameFlags map the tables and columns of the from-dsn to their names in the
+// to-dsn.
+var renameFlags = []cli.Flag{
+	newGenericFlag("rename-table", "Table that has another name in the to-dsn, as from_table=to_table", func() cli.Generic { return tableRenames{} }),
+	newGenericFlag("rename-column", "Column that has another name in the to-dsn, as from_table.from_column=to_column", func() cli.Generic { return columnRenames{} }),
+}
+
+// tableRenames is the value of the --rename-table flag.
+type tableRenames map[string]string
+
+func (r tableRenames) Set(value string) error {
+	from, to, ok := strings.Cut(value, "=")
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if !ok || from == "" || to == "" {
+		return fmt.Errorf("expected from_table=to_table but got %s", value)
+	}
+	r[from] = to
+	return nil
+}
+
+func (r tableRenames) String() string {
+	renames := make([]string, 0, len(r))
+	for from, to := range r {
+		renames = append(renames, from+"="+to)
+	}
+	sort.Strings(renames)
+	return strings.Join(renames, " ")
+}
+
+// columnRenames is the value of the --rename-column flag, keyed by the from
+// table.
+type columnRenames map[string]map[string]string
+
+func (r columnRenames) Set(value string) error {
+	column, to, ok := strings.Cut(value, "=")
+	table, from, hasTable := strings.Cut(column, ".")
+	table, from, to = strings.TrimSpace(table), strings.TrimSpace(from), strings.TrimSpace(to)
+	if !ok || !hasTable || table == "" || from == "" || to == "" {
+		return fmt.Errorf("expected from_table.from_column=to_column but got %s", value)
+	}
+	if r[table] == nil {
+		r[table] = map[string]string{}
+	}
+	r[table][from] = to
+	return nil
+}
+
+func (r columnRenames) String() string {
+	renames := []string{}
+	for table, columns := range r {
+		for from, to := range columns {
+			renames = append(renames, table+"."+from+"="+to)
+		}
+	}
+	sort.Strings(renames)
+	return strings.Join(renames, " ")
+}
+
+// loadRenames merges the --rename-table and --rename-column flags over the
+// renames of the config file.
+func loadRenames(ctx *cli.Context, rules map[string]config.Table) (renames datasource.Renames, err error) {
+	renames = datasource.Renames{Tables: map[string]string{}, Columns: map[string]map[string]string{}}
+	for table, rule := range rules {
+		if rule.RenameTo != "" {
+			renames.Tables[table] = rule.RenameTo
+		}
+		for from, to := range rule.RenameColumns {
+			if renames.Columns[table] == nil {
+				renames.Columns[table] = map[string]string{}
+			}
+			renames.Columns[table][from] = to
+		}
+	}
+	if tables, ok := ctx.Generic("rename-table").(tableRenames); ok {
+		for from, to := range tables {
+			renames.Tables[from] = to
+		}
+	}
+	if columns, ok := ctx.Generic("rename-column").(columnRenames); ok {
+		for table, cols := range columns {
+			if renames.Columns[table] == nil {
+				renames.Columns[table] = map[string]string{}
+			}
+			for from, to := range cols {
+				renames.Columns[table][from] = to
+			}
+		}
+	}
+	if err = uniqueRenames("tables", renames.Tables); err != nil {
+		return
+	}
+	for table, columns := range renames.Columns {
+		if err = uniqueRenames("columns of table "+table, columns); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// uniqueRenames checks that no two names are renamed to the same name, which
+// couldn't be told apart in the to-dsn.
+func uniqueRenames(what string, renames map[string]string) error {
+	from := map[string]string{}
+	names := make([]string, 0, len(renames))
+	for name := range renames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		to := renames[name]
+		if other, ok := from[to]; ok {
+			return fmt.Errorf("%s %s and %s are both renamed to %s", what, other, name, to)
+		}
+		from[to] = name
+	}
+	return nil
+}
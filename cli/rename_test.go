@@ -0,0 +1,38 @@
+package cli
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+func renameContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range renameFlags {
+		if err := f.Apply(set); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cli.NewContext(nil, set, nil)
+}
+
+func TestLoadRenames(t *testing.T) {
+	renames, err := loadRenames(renameContext(t, "--rename-table", "orders=order_lines", "--rename-column", "orders.total=amount"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renames.Table("orders") != "order_lines" || renames.Column("orders", "total") != "amount" {
+		t.Errorf("unexpected renames %+v", renames)
+	}
+	// the values of one run don't carry over to the next
+	if renames, err = loadRenames(renameContext(t), nil); err != nil || !renames.Empty() {
+		t.Errorf("expected no renames, got %+v, %v", renames, err)
+	}
+	if _, err = loadRenames(renameContext(t, "--rename-table", "a=c", "--rename-table", "b=c"), nil); err == nil {
+		t.Error("expected two tables renamed to the same name to fail")
+	}
+}
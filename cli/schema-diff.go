@@ -0,0 +1,323 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"sqlcmp/datasource"
+	"sqlcmp/datasource/dialect"
+	"sqlcmp/datasource/dsn"
+	"sqlcmp/datasource/schema"
+	"sqlcmp/migrate"
+	"sqlcmp/report"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v2"
+)
+
+var schemaDiffFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "format",
+		Usage: "Output format (text, json, yaml, sql)",
+		Value: "text",
+	},
+	&cli.StringFlag{
+		Name:  "dialect",
+		Usage: "SQL dialect of the sql format, defaults to the driver of the to-dsn",
+	},
+	junitFlag,
+	failOnFlag(schemaDiffCategories...),
+}
+
+// schemaDiffCategories are the findings of schema-diff
+var schemaDiffCategories = []string{"tables", "columns", "indexes", "foreign-keys", "triggers"}
+
+var schemaDiffCmd = &cli.Command{
+	Name:      "schema-diff",
+	ArgsUsage: "[from] [to]",
+	Usage:     "compare the schema of two data sources",
+	Flags:     append(append(schemaDiffFlags, renameFlags...), sharedFlags...),
+	Action: func(cCtx *cli.Context) (err error) {
+		sources, err := loadSources(cCtx)
+		if err != nil {
+			return err
+		}
+		if sources.FromDSN == "" || sources.ToDSN == "" {
+			return fmt.Errorf("from-dsn and to-dsn are required")
+		}
+		fromDb, err := openSource(cCtx.Context, sources.FromDSN, sources.FromPassword, sources.PromptForPassword, "Enter 'from-dsn' password: ")
+		if err != nil {
+			return err
+		}
+		defer fromDb.Close()
+		toDb, err := openSource(cCtx.Context, sources.ToDSN, sources.ToPassword, sources.PromptForPassword, "Enter 'to-dsn' password: ")
+		if err != nil {
+			return err
+		}
+		defer toDb.Close()
+		toDb = datasource.Renamed(toDb, sources.Renames)
+		ctx, cancel := commandContext(cCtx)
+		defer cancel()
+		defer func() { err = contextError(ctx, err) }()
+		found, err := newFindings(cCtx, schemaDiffCategories...)
+		if err != nil {
+			return err
+		}
+		junit, finishJUnit, err := junitFile(cCtx, "schema-diff")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if endErr := finishJUnit(contextError(ctx, err)); err == nil {
+				err = endErr
+			}
+		}()
+
+		fromTables, err := readSchema(ctx, fromDb, sources)
+		if err != nil {
+			return err
+		}
+		toTables, err := readSchema(ctx, toDb, sources)
+		if err != nil {
+			return err
+		}
+		diffs := schema.Diff(fromTables, toTables)
+		for _, d := range diffs {
+			if d.Status != schema.Changed {
+				found.add("tables", 1)
+				continue
+			}
+			found.add("columns", int64(len(d.Columns)))
+			found.add("indexes", int64(len(d.Indices)))
+			found.add("foreign-keys", int64(len(d.ForeignKeys)))
+			found.add("triggers", int64(len(d.Triggers)))
+		}
+		if junit != nil {
+			if err = addSchemaCases(junit, fromTables, toTables, diffs); err != nil {
+				return
+			}
+		}
+
+		switch cCtx.String("format") {
+		case "sql":
+			var driver string
+			if driver, err = targetDriver(cCtx.String("dialect"), sources.ToDSN); err != nil {
+				return
+			}
+			var d dialect.Dialect
+			if d, err = dialect.Get(driver); err != nil {
+				return
+			}
+			// the statements change to, so they use its names
+			var from, to []schema.Table
+			if from, err = convertSchema(sources.FromDSN, driver, sources.Renames.Schema(fromTables)); err != nil {
+				return
+			}
+			if to, err = convertSchema(sources.ToDSN, driver, sources.Renames.Schema(toTables)); err != nil {
+				return
+			}
+			err = migrate.Write(os.Stdout, d, migrate.Statements(d, from, to))
+		case "text":
+			err = printSchemaDiff(os.Stdout, diffs)
+		case "json":
+			e := json.NewEncoder(os.Stdout)
+			e.SetIndent("", "  ")
+			err = e.Encode(diffs)
+		case "yaml":
+			err = yaml.NewEncoder(os.Stdout).Encode(diffs)
+		default:
+			return fmt.Errorf("invalid format: %s", cCtx.String("format"))
+		}
+		if err != nil {
+			return
+		}
+		return found.exit()
+	},
+}
+
+// targetDialect returns the named dialect or the dialect of the dsn's driver.
+func targetDialect(name, rawDsn string) (dialect.Dialect, error) {
+	driver, err := targetDriver(name, rawDsn)
+	if err != nil {
+		return nil, err
+	}
+	return dialect.Get(driver)
+}
+
+// targetDriver returns name or, when it's empty, the driver of the dsn.
+func targetDriver(name, rawDsn string) (string, error) {
+	if name != "" {
+		return name, nil
+	}
+	cfg, err := dsn.Parse(rawDsn)
+	if err != nil {
+		return "", fmt.Errorf("Invalid dsn: %s\n%w", dsn.Redact(rawDsn), err)
+	}
+	return cfg.Driver, nil
+}
+
+// convertSchema converts tables read from the dsn for the dialect of driver.
+func convertSchema(rawDsn, driver string, tables []schema.Table) ([]schema.Table, error) {
+	from, err := targetDriver("", rawDsn)
+	if err != nil {
+		return nil, err
+	}
+	return dialect.Convert(from, driver, tables)
+}
+
+func readSchema(ctx context.Context, db datasource.DataSource, sources SourceConfig) (tables []schema.Table, err error) {
+	tableNames, err := db.GetTableNamesContext(ctx)
+	if err != nil {
+		return
+	}
+	tableNames = filterTables(tableNames, sources.Tables, sources.ExcludeTables)
+	return db.GetSchemaContext(ctx, tableNames)
+}
+
+// addSchemaCases records every table as a test case that fails when its schema
+// differs.
+func addSchemaCases(junit *report.JUnit, fromTables, toTables []schema.Table, diffs []schema.TableDiff) (err error) {
+	names := []string{}
+	for _, t := range append(append([]schema.Table{}, fromTables...), toTables...) {
+		if indexOf(names, t.Name) < 0 {
+			names = append(names, t.Name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := report.TestCase{Name: name, Class: "schema-diff"}
+		for _, d := range diffs {
+			if d.Name != name {
+				continue
+			}
+			switch d.Status {
+			case schema.Added:
+				c.Failure = "table only exists in to"
+			case schema.Removed:
+				c.Failure = "table only exists in from"
+			default:
+				c.Failure = "table schema differs"
+			}
+			var details strings.Builder
+			if err = printSchemaDiff(&details, []schema.TableDiff{d}); err != nil {
+				return
+			}
+			c.Details = details.String()
+		}
+		junit.Add(c)
+	}
+	return
+}
+
+var statusSymbols = map[schema.Status]string{
+	schema.Added:   "+",
+	schema.Removed: "-",
+	schema.Changed: "~",
+}
+
+func printSchemaDiff(w io.Writer, diffs []schema.TableDiff) (err error) {
+	for _, t := range diffs {
+		if _, err = fmt.Fprintf(w, "%s table `%s`\n", statusSymbols[t.Status], t.Name); err != nil {
+			return
+		}
+		for _, c := range t.Columns {
+			line := fmt.Sprintf("column `%s`", c.Name)
+			switch c.Status {
+			case schema.Added:
+				line += " " + describeColumn(*c.To)
+			case schema.Removed:
+				line += " " + describeColumn(*c.From)
+			case schema.Changed:
+				line += ": " + describeColumn(*c.From) + " -> " + describeColumn(*c.To)
+			}
+			if _, err = fmt.Fprintf(w, "    %s %s\n", statusSymbols[c.Status], line); err != nil {
+				return
+			}
+		}
+		for _, idx := range t.Indices {
+			line := fmt.Sprintf("index `%s`", idx.Name)
+			switch idx.Status {
+			case schema.Added:
+				line += " " + describeIndex(*idx.To)
+			case schema.Removed:
+				line += " " + describeIndex(*idx.From)
+			case schema.Changed:
+				line += ": " + describeIndex(*idx.From) + " -> " + describeIndex(*idx.To)
+			}
+			if _, err = fmt.Fprintf(w, "    %s %s\n", statusSymbols[idx.Status], line); err != nil {
+				return
+			}
+		}
+		for _, fk := range t.ForeignKeys {
+			line := fmt.Sprintf("foreign key `%s`", fk.Name)
+			switch fk.Status {
+			case schema.Added:
+				line += " " + describeForeignKey(fk.To)
+			case schema.Removed:
+				line += " " + describeForeignKey(fk.From)
+			case schema.Changed:
+				line += ": " + describeForeignKey(fk.From) + " -> " + describeForeignKey(fk.To)
+			}
+			if _, err = fmt.Fprintf(w, "    %s %s\n", statusSymbols[fk.Status], line); err != nil {
+				return
+			}
+		}
+		for _, tr := range t.Triggers {
+			line := fmt.Sprintf("trigger `%s`", tr.Name)
+			switch tr.Status {
+			case schema.Added:
+				line += fmt.Sprintf(" %s %s", tr.To.Timing, tr.To.Event)
+			case schema.Removed:
+				line += fmt.Sprintf(" %s %s", tr.From.Timing, tr.From.Event)
+			case schema.Changed:
+				line += " changed " + strings.Join(tr.Changes, ", ")
+			}
+			if _, err = fmt.Fprintf(w, "    %s %s\n", statusSymbols[tr.Status], line); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func describeColumn(c schema.Column) string {
+	parts := []string{c.Type}
+	if !c.IsNullable {
+		parts = append(parts, "NOT NULL")
+	}
+	if c.Default != "" {
+		parts = append(parts, "DEFAULT "+c.Default)
+	}
+	if c.Extra != "" {
+		parts = append(parts, c.Extra)
+	}
+	return strings.Join(parts, " ")
+}
+
+func describeIndex(idx schema.Index) string {
+	kind := idx.Type
+	if idx.Unique {
+		kind = "UNIQUE " + kind
+	}
+	cols := make([]string, len(idx.Columns))
+	for i, col := range idx.Columns {
+		cols[i] = col
+		if i < len(idx.Lengths) && idx.Lengths[i] > 0 {
+			cols[i] = fmt.Sprintf("%s(%d)", col, idx.Lengths[i])
+		}
+	}
+	return fmt.Sprintf("%s (%s)", kind, strings.Join(cols, ", "))
+}
+
+func describeForeignKey(fks []schema.ForeignKey) string {
+	from, to := make([]string, len(fks)), make([]string, len(fks))
+	for i, fk := range fks {
+		from[i], to[i] = fk.FromColumn, fk.ToColumn
+	}
+	return fmt.Sprintf("(%s) references %s (%s)", strings.Join(from, ", "), fks[0].To, strings.Join(to, ", "))
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"sqlcmp/datasource"
+	"sqlcmp/report"
+
+	"github.com/urfave/cli/v2"
+)
+
+var snapshotFlag = &cli.BoolFlag{
+	Name:  "consistent-snapshot",
+	Usage: "Read each source in a single read-only transaction with a consistent snapshot, so concurrent writes don't show up as differences. Can't be used with --parallel",
+}
+
+// startSnapshots starts the snapshots of --consistent-snapshot before anything
+// is read from the sources. snapshots is nil without the flag.
+func startSnapshots(ctx context.Context, cCtx *cli.Context, from, to datasource.DataSource) (snapshots *report.Snapshots, err error) {
+	if !cCtx.Bool(snapshotFlag.Name) {
+		return nil, nil
+	}
+	if cCtx.Int("parallel") > 1 {
+		return nil, errors.New("--consistent-snapshot reads each source through a single connection and can't be used with --parallel")
+	}
+	snapshots = &report.Snapshots{}
+	for _, s := range []struct {
+		name     string
+		source   datasource.DataSource
+		position *string
+	}{{"from", from, &snapshots.From}, {"to", to, &snapshots.To}} {
+		snapshotter, ok := s.source.(datasource.Snapshotter)
+		if !ok {
+			return nil, fmt.Errorf("the %s source doesn't support consistent snapshots", s.name)
+		}
+		if *s.position, err = snapshotter.Snapshot(ctx); err != nil {
+			return nil, fmt.Errorf("failed to start the snapshot of %s:\n%w", s.name, err)
+		}
+		fmt.Fprintf(os.Stderr, "%s snapshot taken at %s\n", s.name, *s.position)
+	}
+	return
+}
@@ -0,0 +1,320 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"sqlcmp/compare"
+	"sqlcmp/datasource"
+	"sqlcmp/datasource/dialect"
+	"sqlcmp/patch"
+
+	"github.com/urfave/cli/v2"
+)
+
+var syncFlags = []cli.Flag{
+	&cli.IntFlag{
+		Name:  "batch-size",
+		Usage: "Number of rows per INSERT or DELETE statement",
+		Value: 100,
+	},
+	&cli.IntFlag{
+		Name:  "tx-size",
+		Usage: "Number of statements per transaction",
+		Value: 100,
+	},
+	&cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Print the statements instead of applying them",
+	},
+	&cli.BoolFlag{
+		Name:  "no-delete",
+		Usage: "Keep rows that only exist in the to-dsn",
+	},
+	&cli.BoolFlag{
+		Name:    "yes",
+		Aliases: []string{"y"},
+		Usage:   "Apply the changes to each table without asking for confirmation",
+	},
+}
+
+var syncCmd = &cli.Command{
+	Name:      "sync",
+	ArgsUsage: "[from] [to]",
+	Usage:     "apply the inserts, updates and deletes that make the to-dsn match the from-dsn",
+	Flags:     append(append(append(append(syncFlags, compareFlags...), renameFlags...), throttleFlags...), sharedFlags...),
+	Action: func(cCtx *cli.Context) (err error) {
+		if err = checkSyncFlags(cCtx); err != nil {
+			return err
+		}
+		sources, err := loadSources(cCtx)
+		if err != nil {
+			return err
+		}
+		if sources.FromDSN == "" || sources.ToDSN == "" {
+			return fmt.Errorf("from-dsn and to-dsn are required")
+		}
+		d, err := targetDialect("", sources.ToDSN)
+		if err != nil {
+			return err
+		}
+		fromDb, err := openSource(cCtx.Context, sources.FromDSN, sources.FromPassword, sources.PromptForPassword, "Enter 'from-dsn' password: ")
+		if err != nil {
+			return err
+		}
+		defer fromDb.Close()
+		toDb, err := openSource(cCtx.Context, sources.ToDSN, sources.ToPassword, sources.PromptForPassword, "Enter 'to-dsn' password: ")
+		if err != nil {
+			return err
+		}
+		defer toDb.Close()
+		toDb = datasource.Renamed(toDb, sources.Renames)
+		ctx, cancel := commandContext(cCtx)
+		defer cancel()
+		defer func() { err = contextError(ctx, err) }()
+		comparison, err := newComparison(cCtx, sources, fromDb, toDb)
+		if err != nil {
+			return err
+		}
+
+		sharedTables, missingTables, _, err := matchTables(ctx, fromDb, toDb, sources)
+		if err != nil {
+			return err
+		}
+		for _, table := range missingTables {
+			fmt.Fprintf(os.Stderr, "skipping missing table: %s\n", table)
+		}
+
+		dryRun, confirm := cCtx.Bool("dry-run"), !cCtx.Bool("yes")
+		stdin := bufio.NewReader(os.Stdin)
+		total := map[compare.Kind]int64{}
+		for _, table := range sharedTables {
+			spool := &syncSpool{dialect: d, batchSize: cCtx.Int("batch-size"), noDelete: cCtx.Bool("no-delete")}
+			fmt.Fprintf(os.Stderr, "comparing table: %s\n", table)
+			_, err = comparison.table(ctx, table, spool)
+			if err == nil {
+				err = syncTable(ctx, spool, toDb.DB(), dryRun, confirm, stdin, cCtx.Int("tx-size"), total)
+			}
+			spool.Close()
+			if err != nil {
+				return err
+			}
+		}
+		if !dryRun {
+			fmt.Fprintf(os.Stderr, "inserted %d, updated %d and deleted %d rows\n", total[compare.OnlyInFrom], total[compare.Changed], total[compare.OnlyInTo])
+		}
+		return
+	},
+}
+
+// checkSyncFlags rejects flag values that sync can't work with.
+func checkSyncFlags(cCtx *cli.Context) error {
+	if cCtx.Int("tx-size") < 1 {
+		return fmt.Errorf("--tx-size has to be at least 1")
+	}
+	return nil
+}
+
+// syncTable applies the spooled statements of a table after asking for
+// confirmation, adding the number of affected rows to total.
+func syncTable(ctx context.Context, spool *syncSpool, db *sql.DB, dryRun, confirm bool, stdin *bufio.Reader, txSize int, total map[compare.Kind]int64) (err error) {
+	if spool.builder == nil {
+		fmt.Fprintf(os.Stderr, "skipping table without a key: %s\n", spool.table.Name)
+		return
+	}
+	summary := fmt.Sprintf("table `%s`: %d inserts, %d updates, %d deletes", spool.table.Name, spool.rows[compare.OnlyInFrom], spool.rows[compare.Changed], spool.rows[compare.OnlyInTo])
+	if spool.statements == 0 {
+		fmt.Fprintln(os.Stderr, summary)
+		return
+	}
+	if dryRun {
+		fmt.Fprintln(os.Stderr, summary)
+		return spool.replay(func(stmt spooledStatement) (err error) {
+			for _, sql := range stmt.SQL {
+				if _, err = fmt.Fprintf(os.Stdout, "%s;\n", sql); err != nil {
+					return
+				}
+			}
+			return
+		})
+	}
+	if confirm {
+		fmt.Fprintf(os.Stderr, "%s. Apply? [y/N] ", summary)
+		answer, err := readLine(ctx, stdin)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			fmt.Fprintf(os.Stderr, "skipping table: %s\n", spool.table.Name)
+			return nil
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, summary)
+	}
+	affected, err := applySpool(ctx, db, spool, txSize)
+	for kind, count := range affected {
+		total[kind] += count
+	}
+	if err != nil {
+		return fmt.Errorf("failed to sync table %s, earlier transactions were committed: %w", spool.table.Name, err)
+	}
+	return
+}
+
+// applySpool executes the spooled statements in transactions of txSize
+// statements and returns the number of rows of each kind that were committed.
+// The rows are counted from the differences rather than from RowsAffected,
+// which drivers report differently for upserts, e.g. MySQL counts an updated
+// row twice and an unchanged one not at all.
+func applySpool(ctx context.Context, db *sql.DB, spool *syncSpool, txSize int) (affected map[compare.Kind]int64, err error) {
+	affected = map[compare.Kind]int64{}
+	pending := map[compare.Kind]int64{}
+	var tx *sql.Tx
+	commit := func() (err error) {
+		if err = tx.Commit(); err != nil {
+			return
+		}
+		tx = nil
+		for kind, rows := range pending {
+			affected[kind] += rows
+		}
+		clear(pending)
+		return
+	}
+	count := 0
+	err = spool.replay(func(stmt spooledStatement) (err error) {
+		if tx == nil {
+			if tx, err = db.BeginTx(ctx, nil); err != nil {
+				return
+			}
+		}
+		for _, sql := range stmt.SQL {
+			if _, err = tx.ExecContext(ctx, sql); err != nil {
+				return
+			}
+		}
+		pending[stmt.Kind] += stmt.Rows
+		if count++; count%txSize == 0 {
+			err = commit()
+		}
+		return
+	})
+	if tx != nil {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		err = commit()
+	}
+	return
+}
+
+// readLine reads a line from stdin, giving up when ctx is done because the
+// signals that would otherwise end a blocked read are caught by the command.
+func readLine(ctx context.Context, stdin *bufio.Reader) (line string, err error) {
+	type result struct {
+		line string
+		err  error
+	}
+	read := make(chan result, 1)
+	go func() {
+		line, err := stdin.ReadString('\n')
+		read <- result{line, err}
+	}()
+	select {
+	case r := <-read:
+		return r.line, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+type spooledStatement struct {
+	Kind compare.Kind
+	// SQL holds statements that are applied in the same transaction
+	SQL []string
+	// Rows is the number of differences the statement fixes
+	Rows int64
+}
+
+// syncSpool writes the statements that reconcile a table to a temporary file
+// so the table can be compared without holding the differences in memory.
+type syncSpool struct {
+	dialect    dialect.Dialect
+	batchSize  int
+	noDelete   bool
+	table      compare.Table
+	file       *os.File
+	enc        *gob.Encoder
+	builder    *patch.Builder
+	statements int
+	rows       map[compare.Kind]int64
+	// spooled is the part of rows that statements were written for
+	spooled map[compare.Kind]int64
+}
+
+func (s *syncSpool) Start(info tableInfo) (err error) {
+	if s.file, err = os.CreateTemp("", "sqlcmp-sync-*.gob"); err != nil {
+		return
+	}
+	s.table = info.Table
+	table := info.Target
+	s.enc = gob.NewEncoder(s.file)
+	s.rows, s.spooled = map[compare.Kind]int64{}, map[compare.Kind]int64{}
+	if len(table.Key) == 0 {
+		return
+	}
+	s.builder = patch.NewBuilder(s.dialect, table, info.UniqueKey, s.batchSize, func(kind compare.Kind, stmts ...string) error {
+		s.statements++
+		rows := s.rows[kind] - s.spooled[kind]
+		s.spooled[kind] = s.rows[kind]
+		return s.enc.Encode(spooledStatement{Kind: kind, SQL: stmts, Rows: rows})
+	})
+	return
+}
+
+func (s *syncSpool) Difference(d compare.Difference) error {
+	if s.builder == nil || (s.noDelete && d.Kind == compare.OnlyInTo) {
+		return nil
+	}
+	s.rows[d.Kind]++
+	return s.builder.Add(d)
+}
+
+func (s *syncSpool) Done(counts compare.Counts, failure error) error {
+	if s.builder == nil || failure != nil {
+		return nil
+	}
+	return s.builder.Flush()
+}
+
+func (s *syncSpool) replay(fn func(stmt spooledStatement) error) (err error) {
+	if _, err = s.file.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	dec := gob.NewDecoder(bufio.NewReader(s.file))
+	for {
+		var stmt spooledStatement
+		if err = dec.Decode(&stmt); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return
+		}
+		if err = fn(stmt); err != nil {
+			return
+		}
+	}
+}
+
+func (s *syncSpool) Close() {
+	if s.file != nil {
+		s.file.Close()
+		os.Remove(s.file.Name())
+	}
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"path/filepath"
+	"testing"
+
+	"sqlcmp/compare"
+	"sqlcmp/datasource"
+	"sqlcmp/datasource/dialect"
+	_ "sqlcmp/datasource/sqlite"
+
+	"github.com/urfave/cli/v2"
+)
+
+func TestCheckSyncFlags(t *testing.T) {
+	cases := map[string]bool{"0": false, "-1": false, "1": true, "100": true}
+	for txSize, ok := range cases {
+		set := flag.NewFlagSet("test", flag.ContinueOnError)
+		for _, f := range syncFlags {
+			if err := f.Apply(set); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := set.Parse([]string{"--tx-size", txSize}); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkSyncFlags(cli.NewContext(nil, set, nil)); (err == nil) != ok {
+			t.Errorf("--tx-size %s: expected ok %v, got %v", txSize, ok, err)
+		}
+	}
+}
+
+func TestApplySpool(t *testing.T) {
+	source, err := datasource.OpenDSN("sqlite3://" + filepath.Join(t.TempDir(), "to.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	if _, err = source.DB().Exec("CREATE TABLE t (id INTEGER PRIMARY KEY, v TEXT); INSERT INTO t VALUES (1, 'a'), (2, 'b'), (3, 'c')"); err != nil {
+		t.Fatal(err)
+	}
+	d, err := dialect.Get("sqlite3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spool := &syncSpool{dialect: d, batchSize: 2}
+	defer spool.Close()
+	table := compare.Table{Name: "t", Columns: []string{"id", "v"}, Key: []int{0}}
+	if err = spool.Start(tableInfo{Table: table, Target: table}); err != nil {
+		t.Fatal(err)
+	}
+	row := func(id, v string) compare.Row { return compare.Row{[]byte(id), []byte(v)} }
+	for _, diff := range []compare.Difference{
+		{Kind: compare.OnlyInFrom, Key: compare.Row{[]byte("4")}, From: row("4", "d")},
+		{Kind: compare.Changed, Key: compare.Row{[]byte("1")}, From: row("1", "x"), To: row("1", "a"), Columns: []int{1}},
+		{Kind: compare.OnlyInFrom, Key: compare.Row{[]byte("5")}, From: row("5", "e")},
+		{Kind: compare.OnlyInFrom, Key: compare.Row{[]byte("6")}, From: row("6", "f")},
+		{Kind: compare.OnlyInTo, Key: compare.Row{[]byte("2")}, To: row("2", "b")},
+	} {
+		if err = spool.Difference(diff); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = spool.Done(compare.Counts{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	affected, err := applySpool(context.Background(), source.DB(), spool, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected[compare.OnlyInFrom] != 3 || affected[compare.Changed] != 1 || affected[compare.OnlyInTo] != 1 {
+		t.Errorf("expected 3 inserts, 1 update and 1 delete, got %v", affected)
+	}
+	var count int
+	if err = source.DB().QueryRow("SELECT COUNT(*) FROM t").Scan(&count); err != nil || count != 5 {
+		t.Errorf("expected 5 rows, got %d, %v", count, err)
+	}
+}
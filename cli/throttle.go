@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"sqlcmp/datasource"
+	"sqlcmp/throttle"
+
+	"github.com/urfave/cli/v2"
+)
+
+// throttleFlags limit the load that comparing puts on each source.
+var throttleFlags = []cli.Flag{
+	&cli.Float64Flag{
+		Name:  "max-rows-per-second",
+		Usage: "Read at most this many rows a second from each source, including the rows hashed in checksum mode",
+	},
+	&cli.Float64Flag{
+		Name:  "max-mb-per-second",
+		Usage: "Read at most this many megabytes a second from each source",
+	},
+	&cli.Int64Flag{
+		Name:  "sleep-every-rows",
+		Usage: "Sleep for --sleep after reading this many rows from a source",
+	},
+	&cli.DurationFlag{
+		Name:  "sleep",
+		Usage: "How long to sleep after every --sleep-every-rows rows, e.g. 100ms",
+	},
+	&cli.StringFlag{
+		Name:  "load-query",
+		Usage: "Query that returns the load of a source, e.g. SHOW REPLICA STATUS or the Threads_running status. Reads pause while it's above --load-threshold",
+	},
+	&cli.StringFlag{
+		Name:  "load-column",
+		Usage: "Column of the --load-query result that holds the load, e.g. Seconds_Behind_Source, the first column by default",
+	},
+	&cli.Float64Flag{
+		Name:  "load-threshold",
+		Usage: "Load above which reads pause, NULL counts as above it",
+	},
+	&cli.DurationFlag{
+		Name:  "load-check-interval",
+		Usage: "How often the load is checked, also while paused",
+		Value: 5 * time.Second,
+	},
+	&cli.StringFlag{
+		Name:  "load-check-source",
+		Usage: "Sources the load is checked on (from, to, both)",
+		Value: "both",
+	},
+}
+
+// newThrottles returns the throttles of the sources, they are nil when no
+// limits are set.
+func newThrottles(cCtx *cli.Context, from, to datasource.DataSource) (fromThrottle, toThrottle *throttle.Throttle, err error) {
+	opts := throttle.Options{
+		RowsPerSecond:  cCtx.Float64("max-rows-per-second"),
+		BytesPerSecond: cCtx.Float64("max-mb-per-second") * 1024 * 1024,
+		ChunkRows:      cCtx.Int64("sleep-every-rows"),
+		ChunkSleep:     cCtx.Duration("sleep"),
+	}
+	if opts.RowsPerSecond < 0 || opts.BytesPerSecond < 0 || opts.ChunkRows < 0 || opts.ChunkSleep < 0 {
+		return nil, nil, fmt.Errorf("throttling limits can't be negative")
+	}
+	if (opts.ChunkRows > 0) != (opts.ChunkSleep > 0) {
+		return nil, nil, fmt.Errorf("--sleep-every-rows and --sleep have to be given together")
+	}
+	query := cCtx.String("load-query")
+	checkFrom, checkTo := false, false
+	if query != "" {
+		if !cCtx.IsSet("load-threshold") {
+			return nil, nil, fmt.Errorf("--load-query needs a --load-threshold")
+		}
+		if cCtx.Duration("load-check-interval") <= 0 {
+			return nil, nil, fmt.Errorf("--load-check-interval has to be positive")
+		}
+		switch source := cCtx.String("load-check-source"); source {
+		case "from":
+			checkFrom = true
+		case "to":
+			checkTo = true
+		case "both":
+			checkFrom, checkTo = true, true
+		default:
+			return nil, nil, fmt.Errorf("unknown load-check-source: %s", source)
+		}
+	}
+	limited := opts.RowsPerSecond > 0 || opts.BytesPerSecond > 0 || opts.ChunkRows > 0
+	newThrottle := func(name string, source datasource.DataSource, check bool) *throttle.Throttle {
+		if !limited && !check {
+			return nil
+		}
+		opts := opts
+		if check {
+			// the pool of the source, so the check doesn't wait for the reads of a
+			// snapshot
+			opts.Check = &throttle.Check{
+				DB:        source.DB(),
+				Query:     query,
+				Column:    cCtx.String("load-column"),
+				Threshold: cCtx.Float64("load-threshold"),
+				Interval:  cCtx.Duration("load-check-interval"),
+			}
+		}
+		return throttle.New(name, opts, os.Stderr)
+	}
+	return newThrottle("from", from, checkFrom), newThrottle("to", to, checkTo), nil
+}
@@ -7,9 +7,6 @@ import (
 	"sort"
 	"strings"
 
-	"sqlcmp/datasource"
-	"sqlcmp/datasource/dsn"
-
 	"github.com/urfave/cli/v2"
 	"gopkg.in/yaml.v2"
 )
@@ -23,39 +20,36 @@ var schemaFlags = []cli.Flag{
 }
 
 var schemaCmd = &cli.Command{
-	Name:  "schema",
-	Usage: "view schema of a data source",
-	Flags: append(schemaFlags, sharedFlags...),
+	Name:      "schema",
+	ArgsUsage: "[source]",
+	Usage:     "view schema of a data source",
+	Flags:     append(schemaFlags, sharedFlags...),
 	Action: func(cCtx *cli.Context) (err error) {
-		sources := flagsToSources(cCtx)
-		if sources.FromDSN == "" {
-			return fmt.Errorf("from-dsn is required")
-		}
-
-		cfg, err := dsn.Parse(sources.FromDSN)
+		sources, err := loadSources(cCtx)
 		if err != nil {
 			return err
 		}
-		if sources.PromptForPassword {
-			if err = ensurePassword(&cfg, ""); err != nil {
-				return
-			}
+		if sources.FromDSN == "" {
+			return fmt.Errorf("from-dsn is required")
 		}
 
-		db, err := datasource.Open(cfg)
+		db, err := openSource(cCtx.Context, sources.FromDSN, sources.FromPassword, sources.PromptForPassword, "")
 		if err != nil {
 			return err
 		}
 		defer db.Close()
+		ctx, cancel := commandContext(cCtx)
+		defer cancel()
+		defer func() { err = contextError(ctx, err) }()
 
-		tableNames, err := db.GetTableNames()
+		tableNames, err := db.GetTableNamesContext(ctx)
 		if err != nil {
 			return err
 		}
 		tableNames = filterTables(tableNames, sources.Tables, sources.ExcludeTables)
 		fmt.Fprintln(os.Stderr, "Tables: ", strings.Join(tableNames, ","))
 
-		tables, err := db.GetSchema(tableNames)
+		tables, err := db.GetSchemaContext(ctx, tableNames)
 		if err != nil {
 			return err
 		}
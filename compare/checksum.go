@@ -0,0 +1,208 @@
+package compare
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"sqlcmp/datasource"
+	"sqlcmp/datasource/schema"
+)
+
+type ChecksumOptions struct {
+	// ChunkSize is the number of rows in each range that is hashed
+	ChunkSize int
+	// RowThreshold is the number of rows below which a mismatching range is
+	// compared row by row instead of being split further
+	RowThreshold int
+}
+
+// splitFactor is the number of smaller ranges a mismatching range is split into
+const splitFactor = 10
+
+// maxDepth stops splitting ranges whose rows are spread unevenly between the
+// sources
+const maxDepth = 16
+
+// Checksum compares a table by hashing ranges of keys on both sources and only
+// reads the rows of the ranges whose hashes differ. Ranges are split until they
+// have fewer than RowThreshold rows and are then compared by Rows, so fn gets
+// the same differences, in the order of the ranges. Both sources must have the
+// same KeyOrder for the table and its key can't be NULL.
+func Checksum(ctx context.Context, from, to datasource.Checksummer, table Table, opts ChecksumOptions, fn func(Difference) error) (counts Counts, err error) {
+	if opts.ChunkSize < 1 {
+		opts.ChunkSize = 1
+	}
+	if opts.RowThreshold < 1 {
+		opts.RowThreshold = 1
+	}
+	c := newChecksummer(ctx, from, to, table, opts, fn)
+	err = c.split(from, datasource.KeyRange{}, opts.ChunkSize, 0)
+	return c.counts, err
+}
+
+// Ranges compares a table like Rows but reads it in ranges of about chunkSize
+// rows of the from source, so no query stays open for long, e.g. while the
+// reads are throttled. The sources have the same requirements as for Checksum.
+func Ranges(ctx context.Context, from, to datasource.Checksummer, table Table, chunkSize int, fn func(Difference) error) (counts Counts, err error) {
+	c := newChecksummer(ctx, from, to, table, ChecksumOptions{ChunkSize: max(chunkSize, 1)}, fn)
+	c.rowsOnly = true
+	err = c.split(from, datasource.KeyRange{}, c.opts.ChunkSize, 0)
+	return c.counts, err
+}
+
+func newChecksummer(ctx context.Context, from, to datasource.Checksummer, table Table, opts ChecksumOptions, fn func(Difference) error) *checksummer {
+	c := &checksummer{ctx: ctx, from: from, to: to, table: table, opts: opts, fn: fn}
+	c.key = make([]string, len(table.Key))
+	for i, k := range table.Key {
+		c.key[i] = table.Columns[k]
+	}
+	return c
+}
+
+type checksummer struct {
+	ctx      context.Context
+	from, to datasource.Checksummer
+	table    Table
+	key      []string
+	opts     ChecksumOptions
+	// rowsOnly compares every range row by row without hashing it
+	rowsOnly bool
+	fn       func(Difference) error
+	counts   Counts
+}
+
+// split compares the range in chunks of size rows of src.
+func (c *checksummer) split(src datasource.Checksummer, r datasource.KeyRange, size, depth int) (err error) {
+	after := r.After
+	for {
+		boundary, err := src.KeyBoundary(c.ctx, c.table.Name, c.key, datasource.KeyRange{After: after, Through: r.Through}, size)
+		if err != nil {
+			return err
+		}
+		through := boundary
+		if boundary == nil {
+			through = r.Through
+		}
+		if err = c.compareRange(datasource.KeyRange{After: after, Through: through}, depth); err != nil || boundary == nil {
+			return err
+		}
+		after = boundary
+	}
+}
+
+// compareRange hashes the range on both sources and splits it up when they
+// don't match.
+func (c *checksummer) compareRange(r datasource.KeyRange, depth int) (err error) {
+	if c.rowsOnly {
+		return c.compareRows(r)
+	}
+	fromSum, fromCount, err := c.from.Checksum(c.ctx, c.table.Name, c.table.Columns, c.key, r)
+	if err != nil {
+		return
+	}
+	toSum, toCount, err := c.to.Checksum(c.ctx, c.table.Name, c.table.Columns, c.key, r)
+	if err != nil {
+		return
+	}
+	if fromSum == toSum && fromCount == toCount {
+		c.counts.Matched += fromCount
+		return
+	}
+	src, count := c.from, fromCount
+	if toCount > fromCount {
+		src, count = c.to, toCount
+	}
+	if count <= int64(c.opts.RowThreshold) || depth >= maxDepth {
+		return c.compareRows(r)
+	}
+	size := int(count / splitFactor)
+	if size < c.opts.RowThreshold {
+		size = c.opts.RowThreshold
+	}
+	return c.split(src, r, size, depth+1)
+}
+
+// compareRows compares the rows of the range. The sources return them in the
+// order of their collation, so both sides are read into memory and sorted by
+// key before they're merged.
+func (c *checksummer) compareRows(r datasource.KeyRange) (err error) {
+	fromRows, err := c.readRange(c.from, r, c.table.FromKinds, c.table.Options.FromLocation)
+	if err != nil {
+		return
+	}
+	toRows, err := c.readRange(c.to, r, c.table.ToKinds, c.table.Options.ToLocation)
+	if err != nil {
+		return
+	}
+	counts, err := Rows(fromRows, toRows, c.table, c.fn)
+	c.counts.Matched += counts.Matched
+	c.counts.OnlyInFrom += counts.OnlyInFrom
+	c.counts.OnlyInTo += counts.OnlyInTo
+	c.counts.Changed += counts.Changed
+	return
+}
+
+// readRange reads the rows of the range sorted by their normalized key.
+func (c *checksummer) readRange(src datasource.Checksummer, r datasource.KeyRange, kinds []schema.Kind, loc *time.Location) (rows *rowIterator, err error) {
+	iter, err := src.RangeIterator(c.ctx, c.table.Name, c.table.Columns, c.key, r)
+	if err != nil {
+		return
+	}
+	rows = &rowIterator{table: c.table}
+	for {
+		row := newRow(len(c.table.Columns))
+		ok, err := next(iter, row)
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		rows.rows = append(rows.rows, row)
+		rows.norm = append(rows.norm, c.table.normalize(row, kinds, loc))
+	}
+	if err = iter.Close(); err != nil {
+		return
+	}
+	sort.Stable(rows)
+	return
+}
+
+// rowIterator iterates rows that were read into memory.
+type rowIterator struct {
+	table Table
+	rows  []Row
+	// norm holds the normalized rows that are sorted by
+	norm []Row
+	i    int
+}
+
+func (r *rowIterator) Len() int           { return len(r.rows) }
+func (r *rowIterator) Less(i, j int) bool { return r.table.compareKeys(r.norm[i], r.norm[j]) < 0 }
+func (r *rowIterator) Swap(i, j int) {
+	r.rows[i], r.rows[j] = r.rows[j], r.rows[i]
+	r.norm[i], r.norm[j] = r.norm[j], r.norm[i]
+}
+
+func (r *rowIterator) Next() bool {
+	r.i++
+	return r.i <= len(r.rows)
+}
+
+func (r *rowIterator) Columns() ([]string, error) { return r.table.Columns, nil }
+func (r *rowIterator) Err() error                 { return nil }
+func (r *rowIterator) Close() error               { return nil }
+
+func (r *rowIterator) Scan(dest ...interface{}) error {
+	for i, v := range r.rows[r.i-1] {
+		// a nil slice in an interface isn't nil, but NULL has to stay NULL
+		if v == nil {
+			*dest[i].(*interface{}) = nil
+		} else {
+			*dest[i].(*interface{}) = v
+		}
+	}
+	return nil
+}
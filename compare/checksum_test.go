@@ -0,0 +1,70 @@
+package compare
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"sqlcmp/datasource"
+	"sqlcmp/datasource/schema"
+)
+
+// caseless is a Checksummer whose single range is sorted without regard to
+// case, like a case insensitive collation.
+type caseless struct {
+	rows [][]interface{}
+}
+
+func (c caseless) KeyOrder(ctx context.Context, table string, key []string) ([]string, error) {
+	return []string{"caseless"}, nil
+}
+
+func (c caseless) KeyBoundary(ctx context.Context, table string, key []string, r datasource.KeyRange, offset int) ([]string, error) {
+	return nil, nil
+}
+
+func (c caseless) Checksum(ctx context.Context, table string, columns, key []string, r datasource.KeyRange) (string, int64, error) {
+	return fmt.Sprint(c.rows), int64(len(c.rows)), nil
+}
+
+func (c caseless) RangeIterator(ctx context.Context, table string, columns, key []string, r datasource.KeyRange) (schema.RecordIterator, error) {
+	return iter(c.rows...), nil
+}
+
+func TestChecksumSortsRanges(t *testing.T) {
+	from := caseless{rows: [][]interface{}{{"a", "1"}, {"B", "2"}, {"c", "3"}}}
+	to := caseless{rows: [][]interface{}{{"a", "1"}, {"B", "x"}, {"C", "3"}}}
+	table := Table{Name: "t", Columns: []string{"k", "v"}, Key: []int{0}}
+	compares := map[string]func(fn func(Difference) error) (Counts, error){
+		"checksum": func(fn func(Difference) error) (Counts, error) {
+			return Checksum(context.Background(), from, to, table, ChecksumOptions{ChunkSize: 10, RowThreshold: 10}, fn)
+		},
+		"ranges": func(fn func(Difference) error) (Counts, error) {
+			return Ranges(context.Background(), from, to, table, 10, fn)
+		},
+	}
+	for name, compare := range compares {
+		var diffs []Difference
+		counts, err := compare(func(d Difference) error {
+			diffs = append(diffs, d)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := Counts{Matched: 1, OnlyInFrom: 1, OnlyInTo: 1, Changed: 1}
+		if counts != expected {
+			t.Errorf("%s: expected counts %+v, got %+v", name, expected, counts)
+		}
+		// B and C sort before a by their bytes
+		kinds, keys := []Kind{Changed, OnlyInTo, OnlyInFrom}, []string{"B", "C", "c"}
+		if len(diffs) != len(kinds) {
+			t.Fatalf("%s: expected %d differences, got %d", name, len(kinds), len(diffs))
+		}
+		for i, d := range diffs {
+			if d.Kind != kinds[i] || string(d.Key[0]) != keys[i] {
+				t.Errorf("%s: expected difference %d to be %s of %s, got %s of %s", name, i, kinds[i], keys[i], d.Kind, d.Key[0])
+			}
+		}
+	}
+}
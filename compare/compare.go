@@ -0,0 +1,235 @@
+package compare
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"sqlcmp/datasource/schema"
+)
+
+type Kind int
+
+const (
+	OnlyInFrom Kind = iota
+	OnlyInTo
+	Changed
+)
+
+func (k Kind) String() string {
+	switch k {
+	case OnlyInFrom:
+		return "only_in_from"
+	case OnlyInTo:
+		return "only_in_to"
+	case Changed:
+		return "changed"
+	}
+	return fmt.Sprintf("Kind(%d)", int(k))
+}
+
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Row holds the raw column values of a single record. A nil value is NULL.
+type Row [][]byte
+
+// Table describes how the rows of a table should be lined up. Both iterators
+// must yield Columns in this order, sorted by the Key columns.
+type Table struct {
+	Name    string
+	Columns []string
+	Key     []int
+	// FromKinds and ToKinds hold the kind of each column on either side. Values
+	// of unknown kinds are compared by their bytes.
+	FromKinds []schema.Kind
+	ToKinds   []schema.Kind
+	Options   Options
+	// Tolerances holds how far apart the values of each column may be, columns
+	// past its end must be equal. They don't apply to tables without a key.
+	Tolerances []Tolerance
+}
+
+// KeyOf returns the values of the key columns of the row.
+func (t Table) KeyOf(row Row) Row {
+	key := make(Row, len(t.Key))
+	for i, k := range t.Key {
+		key[i] = row[k]
+	}
+	return key
+}
+
+type Difference struct {
+	Kind Kind
+	Key  Row
+	From Row
+	To   Row
+	// Columns holds the indexes of the columns that differ when Kind is Changed
+	Columns []int
+	// Count is how many more copies of the row one side has when the table is
+	// compared without a key
+	Count int64
+}
+
+type Counts struct {
+	Matched    int64 `json:"matched"`
+	OnlyInFrom int64 `json:"only_in_from"`
+	OnlyInTo   int64 `json:"only_in_to"`
+	Changed    int64 `json:"changed"`
+}
+
+// Differences returns the total number of rows that didn't match.
+func (c Counts) Differences() int64 {
+	return c.OnlyInFrom + c.OnlyInTo + c.Changed
+}
+
+// Rows walks both iterators in key order and calls fn for every row that is
+// missing from one side or has different values. Only the current row of each
+// iterator is held in memory.
+func Rows(from, to schema.RecordIterator, table Table, fn func(Difference) error) (counts Counts, err error) {
+	fromRow, toRow := newRow(len(table.Columns)), newRow(len(table.Columns))
+	fromOk, err := next(from, fromRow)
+	if err != nil {
+		return
+	}
+	toOk, err := next(to, toRow)
+	if err != nil {
+		return
+	}
+	var fromNorm, toNorm Row
+	for fromOk || toOk {
+		c := 0
+		switch {
+		case !toOk:
+			c = -1
+		case !fromOk:
+			c = 1
+		default:
+			fromNorm, toNorm = table.normalize(fromRow, table.FromKinds, table.Options.FromLocation), table.normalize(toRow, table.ToKinds, table.Options.ToLocation)
+			c = table.compareKeys(fromNorm, toNorm)
+		}
+		switch {
+		case c < 0:
+			counts.OnlyInFrom++
+			err = fn(Difference{Kind: OnlyInFrom, Key: table.KeyOf(fromRow), From: fromRow})
+		case c > 0:
+			counts.OnlyInTo++
+			err = fn(Difference{Kind: OnlyInTo, Key: table.KeyOf(toRow), To: toRow})
+		default:
+			if cols := table.changedColumns(fromNorm, toNorm); len(cols) > 0 {
+				counts.Changed++
+				err = fn(Difference{Kind: Changed, Key: table.KeyOf(fromRow), From: fromRow, To: toRow, Columns: cols})
+			} else {
+				counts.Matched++
+			}
+		}
+		if err != nil {
+			return
+		}
+		// fresh rows are scanned for each step so fn is free to keep the old ones
+		if c <= 0 {
+			fromRow = newRow(len(table.Columns))
+			if fromOk, err = next(from, fromRow); err != nil {
+				return
+			}
+		}
+		if c >= 0 {
+			toRow = newRow(len(table.Columns))
+			if toOk, err = next(to, toRow); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func newRow(size int) Row {
+	return make(Row, size)
+}
+
+func next(iter schema.RecordIterator, row Row) (ok bool, err error) {
+	if !iter.Next() {
+		return false, iter.Err()
+	}
+	values := make([]interface{}, len(row))
+	dest := make([]interface{}, len(row))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = iter.Scan(dest...); err != nil {
+		return false, err
+	}
+	for i, v := range values {
+		row[i] = toBytes(v)
+	}
+	return true, nil
+}
+
+// toBytes converts the value returned by a driver into its text form so rows
+// from different drivers can be compared.
+func toBytes(v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return append([]byte{}, v...)
+	case string:
+		return []byte(v)
+	case int64:
+		return strconv.AppendInt(nil, v, 10)
+	case float64:
+		return strconv.AppendFloat(nil, v, 'f', -1, 64)
+	case bool:
+		if v {
+			return []byte("1")
+		}
+		return []byte("0")
+	case time.Time:
+		return []byte(v.Format(time.RFC3339Nano))
+	}
+	return []byte(fmt.Sprint(v))
+}
+
+func (t Table) changedColumns(a, b Row) (cols []int) {
+	for i := range a {
+		if !equalValues(a[i], b[i]) && !(i < len(t.Tolerances) && t.Tolerances[i].within(a[i], b[i])) {
+			cols = append(cols, i)
+		}
+	}
+	return
+}
+
+func equalValues(a, b []byte) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return bytes.Equal(a, b)
+}
+
+// normalize returns the canonical form of every value in the row.
+func (t Table) normalize(row Row, kinds []schema.Kind, loc *time.Location) Row {
+	norm := make(Row, len(row))
+	for i, v := range row {
+		norm[i] = normalize(kindAt(kinds, i), loc, t.Options, v)
+	}
+	return norm
+}
+
+// compareKeys orders two normalized rows by their key columns.
+func (t Table) compareKeys(a, b Row) int {
+	for _, k := range t.Key {
+		if c := compareValues(kindAt(t.FromKinds, k), a[k], b[k]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func kindAt(kinds []schema.Kind, i int) schema.Kind {
+	if i < len(kinds) {
+		return kinds[i]
+	}
+	return schema.KindUnknown
+}
@@ -0,0 +1,274 @@
+package compare
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"sqlcmp/datasource/schema"
+)
+
+type sliceIterator struct {
+	rows [][]interface{}
+	i    int
+}
+
+func (s *sliceIterator) Next() bool {
+	s.i++
+	return s.i <= len(s.rows)
+}
+
+func (s *sliceIterator) Columns() ([]string, error) { return nil, nil }
+func (s *sliceIterator) Err() error                 { return nil }
+func (s *sliceIterator) Close() error               { return nil }
+
+func (s *sliceIterator) Scan(dest ...interface{}) error {
+	row := s.rows[s.i-1]
+	if len(dest) != len(row) {
+		return errors.New("wrong number of columns")
+	}
+	for i, v := range row {
+		*dest[i].(*interface{}) = v
+	}
+	return nil
+}
+
+func iter(rows ...[]interface{}) *sliceIterator {
+	return &sliceIterator{rows: rows}
+}
+
+func TestRows(t *testing.T) {
+	from := iter(
+		[]interface{}{"1", "a"},
+		[]interface{}{"2", "b"},
+		[]interface{}{"9", nil},
+		[]interface{}{"10", "d"},
+	)
+	to := iter(
+		[]interface{}{"2", "b"},
+		[]interface{}{"3", "c"},
+		[]interface{}{"9", ""},
+		[]interface{}{"10", "d"},
+		[]interface{}{"11", "e"},
+	)
+	table := Table{Name: "t", Columns: []string{"id", "name"}, Key: []int{0}}
+	var diffs []Difference
+	counts, err := Rows(from, to, table, func(d Difference) error {
+		diffs = append(diffs, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Counts{Matched: 2, OnlyInFrom: 1, OnlyInTo: 2, Changed: 1}
+	if counts != expected {
+		t.Errorf("expected counts %+v, got %+v", expected, counts)
+	}
+	kinds := []Kind{OnlyInFrom, OnlyInTo, Changed, OnlyInTo}
+	keys := []string{"1", "3", "9", "11"}
+	if len(diffs) != len(kinds) {
+		t.Fatalf("expected %d differences, got %d", len(kinds), len(diffs))
+	}
+	for i, d := range diffs {
+		if d.Kind != kinds[i] {
+			t.Errorf("expected difference %d to be %s, got %s", i, kinds[i], d.Kind)
+		}
+		if string(d.Key[0]) != keys[i] {
+			t.Errorf("expected difference %d to have key %s, got %s", i, keys[i], d.Key[0])
+		}
+	}
+	if len(diffs[2].Columns) != 1 || diffs[2].Columns[0] != 1 {
+		t.Errorf("expected column 1 to be changed, got %v", diffs[2].Columns)
+	}
+}
+
+func TestRowsCompositeKey(t *testing.T) {
+	from := iter(
+		[]interface{}{"1", "a", "x"},
+		[]interface{}{"1", "b", "y"},
+	)
+	to := iter(
+		[]interface{}{"1", "b", "y"},
+		[]interface{}{"2", "a", "z"},
+	)
+	table := Table{Name: "t", Columns: []string{"a", "b", "v"}, Key: []int{0, 1}}
+	counts, err := Rows(from, to, table, func(d Difference) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Counts{Matched: 1, OnlyInFrom: 1, OnlyInTo: 1}
+	if counts != expected {
+		t.Errorf("expected counts %+v, got %+v", expected, counts)
+	}
+}
+
+func TestRowsTyped(t *testing.T) {
+	from := iter(
+		[]interface{}{int64(1), "1.50", int64(1), "2024-01-01 10:00:00", ""},
+		[]interface{}{int64(2), "2", int64(0), "2024-01-01 10:00:00", "a"},
+		[]interface{}{int64(10), "3", int64(1), "2024-01-01 10:00:00", "b"},
+	)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	to := iter(
+		[]interface{}{"1.0", "1.5", true, "2024-01-01 11:00:00", nil},
+		[]interface{}{"2", "2.000", "f", "2024-01-01T10:00:00+02:00", "a"},
+		[]interface{}{"10", "3.1", "t", "2024-01-01 11:00:00.000", "b"},
+	)
+	table := Table{
+		Name:      "t",
+		Columns:   []string{"id", "amount", "active", "at", "note"},
+		Key:       []int{0},
+		FromKinds: []schema.Kind{schema.KindInteger, schema.KindDecimal, schema.KindBool, schema.KindDateTime, schema.KindText},
+		ToKinds:   []schema.Kind{schema.KindDecimal, schema.KindDecimal, schema.KindBool, schema.KindDateTime, schema.KindText},
+		Options:   Options{ToLocation: berlin, NullEqualsEmpty: true},
+	}
+	var diffs []Difference
+	counts, err := Rows(from, to, table, func(d Difference) error {
+		diffs = append(diffs, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Counts{Matched: 1, Changed: 2}
+	if counts != expected {
+		t.Errorf("expected counts %+v, got %+v", expected, counts)
+	}
+	if len(diffs) == 2 {
+		if !slices.Equal(diffs[0].Columns, []int{3}) {
+			t.Errorf("expected column 3 of row 2 to be changed, got %v", diffs[0].Columns)
+		}
+		if !slices.Equal(diffs[1].Columns, []int{1}) {
+			t.Errorf("expected column 1 of row 10 to be changed, got %v", diffs[1].Columns)
+		}
+	}
+}
+
+func TestRowsTolerance(t *testing.T) {
+	from := iter(
+		[]interface{}{int64(1), "10.00", "2024-01-01 10:00:00"},
+		[]interface{}{int64(2), "10.00", "2024-01-01 10:00:00"},
+	)
+	to := iter(
+		[]interface{}{int64(1), "10.01", "2024-01-01 10:00:01"},
+		[]interface{}{int64(2), "10.02", "2024-01-01 09:59:58"},
+	)
+	amount, err := ParseTolerance("0.01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at, err := ParseTolerance("1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := []schema.Kind{schema.KindInteger, schema.KindDecimal, schema.KindDateTime}
+	table := Table{Name: "t", Columns: []string{"id", "amount", "at"}, Key: []int{0}, FromKinds: kinds, ToKinds: kinds, Tolerances: []Tolerance{{}, amount, at}}
+	var diffs []Difference
+	counts, err := Rows(from, to, table, func(d Difference) error {
+		diffs = append(diffs, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (Counts{Matched: 1, Changed: 1}); counts != expected {
+		t.Errorf("expected counts %+v, got %+v", expected, counts)
+	}
+	if len(diffs) == 1 && !slices.Equal(diffs[0].Columns, []int{1, 2}) {
+		t.Errorf("expected both columns of row 2 to be changed, got %v", diffs[0].Columns)
+	}
+	if _, err := ParseTolerance("-1"); err == nil {
+		t.Error("expected a negative tolerance to be invalid")
+	}
+}
+
+func TestZeroTolerance(t *testing.T) {
+	for _, s := range []string{"0", "0s", "0.0"} {
+		zero, err := ParseTolerance(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !zero.within([]byte("10"), []byte("10.0")) || !zero.within([]byte("2024-01-01 10:00:00"), []byte("2024-01-01T10:00:00Z")) {
+			t.Errorf("expected tolerance %s to match equal values", s)
+		}
+		if zero.within([]byte("10.00"), []byte("10.01")) || zero.within([]byte("2024-01-01 10:00:00"), []byte("2024-01-01 10:00:01")) {
+			t.Errorf("expected tolerance %s to only match equal values", s)
+		}
+	}
+}
+
+func TestMultiset(t *testing.T) {
+	from := iter(
+		[]interface{}{"a", int64(1)},
+		[]interface{}{"a", int64(1)},
+		[]interface{}{"a", int64(1)},
+		[]interface{}{"b", nil},
+		[]interface{}{"c", int64(2)},
+	)
+	to := iter(
+		[]interface{}{"a", "1"},
+		[]interface{}{"b", nil},
+		[]interface{}{"b", nil},
+		[]interface{}{"c", "2.0"},
+		[]interface{}{"d", "3"},
+	)
+	kinds := []schema.Kind{schema.KindText, schema.KindDecimal}
+	table := Table{Name: "t", Columns: []string{"name", "n"}, FromKinds: kinds, ToKinds: kinds}
+	var diffs []Difference
+	counts, err := Multiset(from, to, table, func(d Difference) error {
+		diffs = append(diffs, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Counts{Matched: 3, OnlyInFrom: 2, OnlyInTo: 2}
+	if counts != expected {
+		t.Errorf("expected counts %+v, got %+v", expected, counts)
+	}
+	if len(diffs) != 3 {
+		t.Fatalf("expected 3 differences, got %d", len(diffs))
+	}
+	if diffs[0].Kind != OnlyInFrom || diffs[0].Count != 2 || string(diffs[0].From[0]) != "a" {
+		t.Errorf("expected 2 more copies of a in from, got %+v", diffs[0])
+	}
+	if diffs[1].Kind != OnlyInTo || diffs[1].Count != 1 || string(diffs[1].To[0]) != "b" {
+		t.Errorf("expected 1 more copy of b in to, got %+v", diffs[1])
+	}
+	if diffs[2].Kind != OnlyInTo || string(diffs[2].To[0]) != "d" {
+		t.Errorf("expected d only in to, got %+v", diffs[2])
+	}
+}
+
+func TestMultisetNullEqualsEmpty(t *testing.T) {
+	// sorted as the sources do, with NULL before the empty string
+	from := iter([]interface{}{nil, "b"}, []interface{}{"", "a"})
+	to := iter([]interface{}{nil, "a"}, []interface{}{"", "b"})
+	kinds := []schema.Kind{schema.KindText, schema.KindText}
+	table := Table{Name: "t", Columns: []string{"name", "note"}, FromKinds: kinds, ToKinds: kinds, Options: Options{NullEqualsEmpty: true}}
+	var diffs []Difference
+	counts, err := Multiset(from, to, table, func(d Difference) error {
+		diffs = append(diffs, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the rows are told apart by NULL and the empty string rather than matched
+	// out of order
+	expected := Counts{OnlyInFrom: 2, OnlyInTo: 2}
+	if counts != expected {
+		t.Errorf("expected counts %+v, got %+v", expected, counts)
+	}
+	kindsFound := make([]Kind, len(diffs))
+	for i, d := range diffs {
+		kindsFound[i] = d.Kind
+	}
+	if expectedKinds := []Kind{OnlyInTo, OnlyInFrom, OnlyInFrom, OnlyInTo}; !slices.Equal(kindsFound, expectedKinds) {
+		t.Errorf("expected differences %v, got %v", expectedKinds, kindsFound)
+	}
+}
@@ -0,0 +1,143 @@
+package compare
+
+import (
+	"time"
+
+	"sqlcmp/datasource/schema"
+)
+
+// Multiset compares the rows of a table that has no key by counting how often
+// each row appears on either side. Both iterators must be sorted by all of the
+// columns, with NULL first, so equal rows follow each other and only the
+// current row of each side is held in memory. fn is called once for each row
+// that appears more often on one side, with Count set to the number of extra
+// copies, in the order of the rows.
+//
+// NullEqualsEmpty isn't applied: the sources sort NULL and empty strings apart,
+// so rows that only match with it wouldn't be read next to each other.
+func Multiset(from, to schema.RecordIterator, table Table, fn func(Difference) error) (counts Counts, err error) {
+	table.Options.NullEqualsEmpty = false
+	fromRun := &rowRun{iter: from, table: table, kinds: table.FromKinds, loc: table.Options.FromLocation}
+	toRun := &rowRun{iter: to, table: table, kinds: table.ToKinds, loc: table.Options.ToLocation}
+	if err = fromRun.advance(); err != nil {
+		return
+	}
+	if err = toRun.advance(); err != nil {
+		return
+	}
+	for fromRun.row != nil || toRun.row != nil {
+		c := 0
+		switch {
+		case toRun.row == nil:
+			c = -1
+		case fromRun.row == nil:
+			c = 1
+		default:
+			c = table.compareRows(fromRun.norm, toRun.norm)
+		}
+		d := Difference{Key: Row{}}
+		switch {
+		case c < 0:
+			d.Kind, d.From, d.Count = OnlyInFrom, fromRun.row, fromRun.count
+		case c > 0:
+			d.Kind, d.To, d.Count = OnlyInTo, toRun.row, toRun.count
+		default:
+			counts.Matched += min(fromRun.count, toRun.count)
+			d.Kind, d.From, d.Count = OnlyInFrom, fromRun.row, fromRun.count-toRun.count
+			if d.Count < 0 {
+				d.Kind, d.From, d.To, d.Count = OnlyInTo, nil, toRun.row, -d.Count
+			}
+		}
+		if d.Count > 0 {
+			if d.Kind == OnlyInFrom {
+				counts.OnlyInFrom += d.Count
+			} else {
+				counts.OnlyInTo += d.Count
+			}
+			if err = fn(d); err != nil {
+				return
+			}
+		}
+		if c <= 0 {
+			if err = fromRun.advance(); err != nil {
+				return
+			}
+		}
+		if c >= 0 {
+			if err = toRun.advance(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// rowRun reads a sorted iterator as runs of equal rows.
+type rowRun struct {
+	iter  schema.RecordIterator
+	table Table
+	kinds []schema.Kind
+	loc   *time.Location
+	// row is the first of the count equal rows of the run, or nil after the
+	// last run, and norm is its normalized form
+	row, norm Row
+	count     int64
+	// next is the first row of the next run
+	next, nextNorm Row
+	done           bool
+}
+
+// advance reads the next run.
+func (r *rowRun) advance() (err error) {
+	if r.next == nil && !r.done {
+		if r.next, r.nextNorm, err = r.read(); err != nil {
+			return
+		}
+	}
+	r.row, r.norm, r.count = r.next, r.nextNorm, 1
+	r.next, r.nextNorm = nil, nil
+	for r.row != nil {
+		row, norm, err := r.read()
+		if err != nil || row == nil {
+			return err
+		}
+		if r.table.compareRows(r.norm, norm) != 0 {
+			r.next, r.nextNorm = row, norm
+			return nil
+		}
+		r.count++
+	}
+	return
+}
+
+// read returns the next row of the iterator, or nil at its end.
+func (r *rowRun) read() (row, norm Row, err error) {
+	if r.done {
+		return
+	}
+	row = newRow(len(r.table.Columns))
+	ok, err := next(r.iter, row)
+	if err != nil || !ok {
+		r.done = true
+		return nil, nil, err
+	}
+	return row, r.table.normalize(row, r.kinds, r.loc), nil
+}
+
+// compareRows orders two normalized rows by all of their columns.
+func (t Table) compareRows(a, b Row) int {
+	for i := range a {
+		switch {
+		case a[i] == nil && b[i] == nil:
+			continue
+		case a[i] == nil:
+			return -1
+		case b[i] == nil:
+			return 1
+		}
+		if c := compareValues(kindAt(t.FromKinds, i), a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
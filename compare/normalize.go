@@ -0,0 +1,188 @@
+package compare
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"sqlcmp/datasource/schema"
+)
+
+type Options struct {
+	// FromLocation and ToLocation are the zones of date times that are read
+	// without an offset. They default to UTC.
+	FromLocation *time.Location
+	ToLocation   *time.Location
+	// NullEqualsEmpty treats empty strings as NULL
+	NullEqualsEmpty bool
+}
+
+// canonicalTime is a fixed width layout so normalized date times sort as text.
+const canonicalTime = "2006-01-02T15:04:05.000000000Z"
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999-07",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// normalize returns the canonical form of a value so equal values of
+// different drivers and column types have the same bytes. Values that can't be
+// parsed as their kind are returned as they are.
+func normalize(kind schema.Kind, loc *time.Location, opts Options, v []byte) []byte {
+	if v == nil {
+		return nil
+	}
+	switch kind {
+	case schema.KindUnknown, schema.KindText:
+		if opts.NullEqualsEmpty && len(v) == 0 {
+			return nil
+		}
+	case schema.KindInteger, schema.KindDecimal, schema.KindFloat:
+		if r, ok := new(big.Rat).SetString(string(v)); ok {
+			return []byte(r.RatString())
+		}
+	case schema.KindBool:
+		switch strings.ToLower(string(v)) {
+		case "1", "t", "true", "y", "yes", "on", "\x01":
+			return []byte("1")
+		case "0", "f", "false", "n", "no", "off", "\x00":
+			return []byte("0")
+		}
+	case schema.KindDateTime:
+		if t, ok := parseTime(v, loc); ok {
+			return []byte(t.UTC().Format(canonicalTime))
+		}
+	case schema.KindDate:
+		// dates are days in whatever zone they were stored in
+		if t, ok := parseTime(v, time.UTC); ok {
+			return []byte(t.Format("2006-01-02"))
+		}
+	case schema.KindTime:
+		if i := bytes.IndexByte(v, '.'); i >= 0 {
+			if frac := bytes.TrimRight(v[i+1:], "0"); len(frac) == 0 {
+				return v[:i]
+			}
+		}
+	}
+	return v
+}
+
+func parseTime(v []byte, loc *time.Location) (t time.Time, ok bool) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	s := string(v)
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return t, false
+}
+
+// compareValues orders two normalized key values the same way the databases
+// do. Text is compared by bytes, so the sources have to order text keys with a
+// binary collation.
+func compareValues(kind schema.Kind, a, b []byte) int {
+	switch {
+	case kind.IsNumeric():
+		if ai, err := strconv.ParseInt(string(a), 10, 64); err == nil {
+			if bi, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+				return compareInts(ai, bi)
+			}
+		}
+		ar, aok := new(big.Rat).SetString(string(a))
+		br, bok := new(big.Rat).SetString(string(b))
+		if aok && bok {
+			return ar.Cmp(br)
+		}
+	case kind == schema.KindUnknown:
+		return guessCompareValues(a, b)
+	}
+	return bytes.Compare(a, b)
+}
+
+// guessCompareValues orders values without a known type the same way the
+// databases do for numbers and falls back to byte order for everything else.
+func guessCompareValues(a, b []byte) int {
+	if ai, err := strconv.ParseInt(string(a), 10, 64); err == nil {
+		if bi, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+			return compareInts(ai, bi)
+		}
+	}
+	if af, err := strconv.ParseFloat(string(a), 64); err == nil {
+		if bf, err := strconv.ParseFloat(string(b), 64); err == nil {
+			switch {
+			case af < bf:
+				return -1
+			case af > bf:
+				return 1
+			}
+			return 0
+		}
+	}
+	return bytes.Compare(a, b)
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Tolerance is how far apart two values of a column may be and still match.
+type Tolerance struct {
+	// Number is the largest difference between two numbers
+	Number *big.Rat
+	// Duration is the largest difference between two dates or date times
+	Duration time.Duration
+}
+
+// ParseTolerance parses a number like 0.01 or a duration like 1s or 1h30m. A
+// tolerance of 0 only matches equal numbers and equal times.
+func ParseTolerance(s string) (t Tolerance, err error) {
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		if d == 0 {
+			return Tolerance{Number: new(big.Rat)}, nil
+		}
+		return Tolerance{Duration: d}, nil
+	}
+	if r, ok := new(big.Rat).SetString(s); ok && r.Sign() >= 0 {
+		return Tolerance{Number: r}, nil
+	}
+	return t, fmt.Errorf("invalid tolerance %q, expected a positive number or duration", s)
+}
+
+// within reports whether two normalized values are within the tolerance.
+func (t Tolerance) within(a, b []byte) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if t.Number != nil {
+		ar, aok := new(big.Rat).SetString(string(a))
+		br, bok := new(big.Rat).SetString(string(b))
+		if aok && bok {
+			return ar.Sub(ar, br).Abs(ar).Cmp(t.Number) <= 0
+		}
+	}
+	// times are compared even without a Duration, so a zero tolerance matches
+	// equal times
+	at, aok := parseTime(a, time.UTC)
+	bt, bok := parseTime(b, time.UTC)
+	if aok && bok {
+		d := at.Sub(bt)
+		return d <= t.Duration && -d <= t.Duration
+	}
+	return false
+}
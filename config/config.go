@@ -0,0 +1,188 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"sqlcmp/compare"
+	"sqlcmp/datasource/credentials"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FileNames are the names of the config files that are discovered.
+var FileNames = []string{"sqlcmp.yaml", "sqlcmp.yml"}
+
+// Config holds the project settings of sqlcmp.yaml:
+//
+//	connections:
+//	  prod:
+//	    dsn: mysql://app@tcp(db.example.com:3306)/app
+//	    password_source: env:PROD_PASSWORD
+//	  staging:
+//	    dsn: mysql://app@tcp(staging.example.com:3306)/app
+//	include_tables: [users, orders]
+//	exclude_tables: [sessions]
+//	tables:
+//	  orders:
+//	    key: [order_id, line]
+//	    ignore_columns: [updated_at]
+//	    tolerances:
+//	      total: 0.01
+//	      created_at: 1s
+//	    rename_to: order_lines
+//	    rename_columns:
+//	      total: amount
+type Config struct {
+	Connections   map[string]Connection `yaml:"connections"`
+	IncludeTables []string              `yaml:"include_tables"`
+	ExcludeTables []string              `yaml:"exclude_tables"`
+	Tables        map[string]Table      `yaml:"tables"`
+}
+
+// Connection is a named data source. Relative paths of sqlite3 dsns are
+// relative to the config file.
+type Connection struct {
+	DSN string `yaml:"dsn"`
+	// PasswordSource is where the password comes from, see credentials.Source
+	PasswordSource string `yaml:"password_source"`
+}
+
+// Table holds the rules for comparing a table.
+type Table struct {
+	// Key overrides the columns that identify the rows of the table
+	Key []string `yaml:"key"`
+	// IgnoreColumns are left out of the comparison
+	IgnoreColumns []string `yaml:"ignore_columns"`
+	// Tolerances holds how far apart the values of a column may be and still
+	// match, as a number or a duration
+	Tolerances map[string]Tolerance `yaml:"tolerances"`
+	// RenameTo is the name of the table in the to source
+	RenameTo string `yaml:"rename_to"`
+	// RenameColumns maps columns to their names in the to source
+	RenameColumns map[string]string `yaml:"rename_columns"`
+}
+
+type Tolerance struct {
+	compare.Tolerance
+}
+
+func (t *Tolerance) UnmarshalYAML(unmarshal func(interface{}) error) (err error) {
+	var s string
+	if err = unmarshal(&s); err != nil {
+		return
+	}
+	t.Tolerance, err = compare.ParseTolerance(s)
+	return
+}
+
+// Load reads a config file. Unknown settings are errors so typos don't go
+// unnoticed.
+func Load(path string) (cfg *Config, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	cfg = &Config{}
+	if err = yaml.UnmarshalStrict(b, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config %s:\n%w", path, err)
+	}
+	for name, conn := range cfg.Connections {
+		if conn.DSN == "" {
+			return nil, fmt.Errorf("invalid config %s: connection %s has no dsn", path, name)
+		}
+		if conn.PasswordSource != "" {
+			if _, err = credentials.ParseSource(conn.PasswordSource); err != nil {
+				return nil, fmt.Errorf("invalid config %s: connection %s:\n%w", path, name, err)
+			}
+		}
+		conn.DSN = relativeTo(filepath.Dir(path), conn.DSN)
+		cfg.Connections[name] = conn
+	}
+	return
+}
+
+// relativeTo makes the relative path of a sqlite3 dsn relative to dir.
+func relativeTo(dir, dsn string) string {
+	const prefix = "sqlite3://"
+	file, ok := strings.CutPrefix(dsn, prefix)
+	if !ok || filepath.IsAbs(file) || strings.HasPrefix(file, "/:memory:") {
+		return dsn
+	}
+	file, params, hasParams := strings.Cut(file, "?")
+	if file = filepath.ToSlash(filepath.Join(dir, file)); !strings.HasPrefix(file, "/") {
+		file = "./" + file
+	}
+	if hasParams {
+		file += "?" + params
+	}
+	return prefix + file
+}
+
+// Find looks for a config file in dir and its parents up to the root of the
+// repository that dir is in, or only in dir when it isn't in a repository, so
+// a stray config file in the home directory doesn't apply to unrelated runs.
+// path is empty when there is none.
+func Find(dir string) (path string, err error) {
+	if dir, err = filepath.Abs(dir); err != nil {
+		return
+	}
+	root, err := repositoryRoot(dir)
+	if err != nil {
+		return
+	}
+	for {
+		for _, name := range FileNames {
+			path = filepath.Join(dir, name)
+			if _, err = os.Stat(path); err == nil {
+				return path, nil
+			} else if !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+		if dir == root {
+			return "", nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// repositoryRoot returns the closest directory above dir that holds a .git, or
+// dir when there is none.
+func repositoryRoot(dir string) (string, error) {
+	for parent := dir; ; {
+		if _, err := os.Stat(filepath.Join(parent, ".git")); err == nil {
+			return parent, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		next := filepath.Dir(parent)
+		if next == parent {
+			return dir, nil
+		}
+		parent = next
+	}
+}
+
+// Connection returns a named connection. Values that already are dsns are
+// returned as a connection with only that dsn.
+func (c *Config) Connection(nameOrDSN string) (Connection, error) {
+	if nameOrDSN == "" || strings.Contains(nameOrDSN, "://") {
+		return Connection{DSN: nameOrDSN}, nil
+	}
+	if conn, ok := c.Connections[nameOrDSN]; ok {
+		return conn, nil
+	}
+	if len(c.Connections) == 0 {
+		return Connection{}, fmt.Errorf("unknown connection %s, expected a dsn or a connection of the config file", nameOrDSN)
+	}
+	names := make([]string, 0, len(c.Connections))
+	for name := range c.Connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return Connection{}, fmt.Errorf("unknown connection %s, expected a dsn or one of: %s", nameOrDSN, strings.Join(names, ", "))
+}
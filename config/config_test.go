@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+connections:
+  prod:
+    dsn: mysql://app@tcp(db:3306)/app
+    password_source: env:PROD_PASSWORD
+  local:
+    dsn: sqlite3://./data/a.db?mode=ro
+exclude_tables: [sessions]
+tables:
+  orders:
+    key: [order_id, line]
+    ignore_columns: [updated_at]
+    tolerances:
+      total: 0.01
+      created_at: 1s
+    rename_to: order_lines
+    rename_columns:
+      total: amount
+`
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sqlcmp.yaml"), []byte(testConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	nested := filepath.Join(dir, "a", "b")
+	for _, d := range []string{nested, filepath.Join(dir, ".git")} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path, err := Find(nested)
+	if err != nil || path != filepath.Join(dir, "sqlcmp.yaml") {
+		t.Fatalf("expected to find the config in a parent directory, got %q, %v", path, err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn, err := cfg.Connection("prod"); err != nil || conn.DSN != "mysql://app@tcp(db:3306)/app" || conn.PasswordSource != "env:PROD_PASSWORD" {
+		t.Errorf("expected the connection prod, got %+v, %v", conn, err)
+	}
+	if conn, err := cfg.Connection("local"); err != nil || conn.DSN != "sqlite3://"+filepath.ToSlash(filepath.Join(dir, "data/a.db"))+"?mode=ro" {
+		t.Errorf("expected the sqlite3 path to be relative to the config, got %q, %v", conn.DSN, err)
+	}
+	if conn, err := cfg.Connection("sqlite3://./a.db"); err != nil || conn.DSN != "sqlite3://./a.db" {
+		t.Errorf("expected dsns to be kept, got %q, %v", conn.DSN, err)
+	}
+	if _, err := cfg.Connection("staging"); err == nil {
+		t.Error("expected an unknown connection to fail")
+	}
+	orders := cfg.Tables["orders"]
+	if len(orders.Key) != 2 || len(orders.IgnoreColumns) != 1 || len(cfg.ExcludeTables) != 1 {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	if total := orders.Tolerances["total"]; total.Number == nil || total.Number.FloatString(2) != "0.01" {
+		t.Errorf("expected a tolerance of 0.01, got %+v", total)
+	}
+	if at := orders.Tolerances["created_at"]; at.Duration != time.Second {
+		t.Errorf("expected a tolerance of 1s, got %+v", at)
+	}
+	if orders.RenameTo != "order_lines" || orders.RenameColumns["total"] != "amount" {
+		t.Errorf("expected orders to be renamed, got %+v", orders)
+	}
+}
+
+func TestFindBoundary(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sqlcmp.yaml"), []byte(testConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	repo, other := filepath.Join(dir, "repo"), filepath.Join(dir, "other")
+	for _, d := range []string{filepath.Join(repo, ".git"), filepath.Join(repo, "a"), other} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the config above the repository and above a directory outside of one
+	// isn't used
+	for _, d := range []string{filepath.Join(repo, "a"), other} {
+		if path, err := Find(d); err != nil || path != "" {
+			t.Errorf("expected no config for %s, got %q, %v", d, path, err)
+		}
+	}
+	if path, err := Find(dir); err != nil || path != filepath.Join(dir, "sqlcmp.yaml") {
+		t.Errorf("expected the config of the directory, got %q, %v", path, err)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for _, content := range []string{
+		"connection:\n  prod:\n    dsn: x\n",
+		"tables:\n  t:\n    tolerances:\n      a: soon\n",
+		"connections:\n  prod: {}\n",
+		"connections:\n  prod:\n    dsn: sqlite3://a.db\n    password_source: vault\n",
+	} {
+		path := filepath.Join(t.TempDir(), "sqlcmp.yaml")
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("expected %q to be invalid", content)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package datasource
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"sqlcmp/datasource/schema"
+)
+
+// KeyRange selects the rows of a table whose key is greater than After and at
+// most Through, in the order the sources iterate the key. A nil bound is open.
+type KeyRange struct {
+	After   []string
+	Through []string
+}
+
+// ByteOrder is the key order of a text column that is sorted by its bytes.
+const ByteOrder = "bytes"
+
+// ErrNullKey is returned by KeyBoundary when a key column of a row is NULL, as
+// ranges can't hold such rows.
+var ErrNullKey = errors.New("key column is NULL")
+
+// Checksummer is implemented by data sources that can hash ranges of a table on
+// the server so only the ranges that differ have to be read.
+type Checksummer interface {
+	// KeyOrder returns how ranges order each key column: an empty string for
+	// columns that aren't text, ByteOrder for text that is sorted by its bytes
+	// and the name of its collation otherwise. Ranges of two sources only hold
+	// the same rows if their key orders are equal.
+	KeyOrder(ctx context.Context, table string, key []string) (order []string, err error)
+	// KeyBoundary returns the key of the row that is offset rows into the range
+	// or nil if the range has fewer rows. The rows are counted from r.After, so
+	// walking a table boundary by boundary reads every row once.
+	KeyBoundary(ctx context.Context, table string, key []string, r KeyRange, offset int) (boundary []string, err error)
+	// Checksum returns a hash of the columns of every row in the range and the
+	// number of rows. The hash only has to match other sources of the same
+	// driver.
+	Checksum(ctx context.Context, table string, columns, key []string, r KeyRange) (sum string, count int64, err error)
+	// RangeIterator iterates the rows in the range sorted by key in the order
+	// of KeyOrder.
+	RangeIterator(ctx context.Context, table string, columns, key []string, r KeyRange) (iterator schema.RecordIterator, err error)
+}
+
+// RangeCondition returns the condition that selects the rows in the range, or
+// an empty string if the range is open, given the expressions the source
+// orders the key by. placeholder returns the placeholder of the nth argument.
+func RangeCondition(keys []string, r KeyRange, placeholder func(n int) string) (cond string, args []interface{}) {
+	conds := []string{}
+	bound := func(op string, values []string) {
+		placeholders := make([]string, len(values))
+		for i, v := range values {
+			args = append(args, v)
+			placeholders[i] = placeholder(len(args))
+		}
+		conds = append(conds, fmt.Sprintf("(%s) %s (%s)", strings.Join(keys, ", "), op, strings.Join(placeholders, ", ")))
+	}
+	if r.After != nil {
+		bound(">", r.After)
+	}
+	if r.Through != nil {
+		bound("<=", r.Through)
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// KeyColumn is what a source needs to know to order a key column.
+type KeyColumn struct {
+	Kind schema.Kind
+	// Order is the key order of the column, see Checksummer.KeyOrder
+	Order    string
+	Nullable bool
+	// Cast tells that the column is cast to text to be sorted by its bytes, as
+	// the database orders its type by something else or not at all, like json
+	// or enums
+	Cast bool
+}
+
+// KeyColumns caches the columns of tables so a source looks them up once per
+// table rather than for every range.
+type KeyColumns struct {
+	mu     sync.Mutex
+	tables map[string]map[string]KeyColumn
+}
+
+// Get returns the columns of the table by name, calling load the first time.
+func (k *KeyColumns) Get(table string, load func() (map[string]KeyColumn, error)) (columns map[string]KeyColumn, err error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if columns, ok := k.tables[table]; ok {
+		return columns, nil
+	}
+	if columns, err = load(); err != nil {
+		return
+	}
+	if k.tables == nil {
+		k.tables = map[string]map[string]KeyColumn{}
+	}
+	k.tables[table] = columns
+	return
+}
+
+// KeyOrderOf returns the key orders of the key columns.
+func KeyOrderOf(columns map[string]KeyColumn, key []string) []string {
+	order := make([]string, len(key))
+	for i, name := range key {
+		order[i] = columns[name].Order
+	}
+	return order
+}
+
+// ScanKeyBoundary scans the key of the row returned by a KeyBoundary query. It
+// returns nil if there is no row and ErrNullKey if a key column is NULL.
+func ScanKeyBoundary(row *sql.Row, key []string) (boundary []string, err error) {
+	values := make([]sql.NullString, len(key))
+	dest := make([]interface{}, len(key))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = row.Scan(dest...); err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+	boundary = make([]string, len(key))
+	for i, v := range values {
+		if !v.Valid {
+			return nil, fmt.Errorf("%w: %s", ErrNullKey, key[i])
+		}
+		boundary[i] = v.String
+	}
+	return
+}
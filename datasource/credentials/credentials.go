@@ -0,0 +1,245 @@
+package credentials
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	dbdsn "sqlcmp/datasource/dsn"
+)
+
+type Kind string
+
+const (
+	// Env reads the password from the environment variable Source.Value
+	Env Kind = "env"
+	// File reads the password from the file Source.Value, e.g. a Docker or
+	// Kubernetes secret
+	File Kind = "file"
+	// Command runs Source.Value with the shell and reads the password from its
+	// stdout
+	Command Kind = "cmd"
+	// MyCnf reads the password of the [client] or [mysql] section of a MySQL
+	// option file, ~/.my.cnf unless Source.Value is set
+	MyCnf Kind = "mycnf"
+	// PgPass reads the password of the first matching line of a PostgreSQL
+	// password file, $PGPASSFILE or ~/.pgpass unless Source.Value is set
+	PgPass Kind = "pgpass"
+	// Prompt asks for the password on the terminal, which is up to the caller
+	Prompt Kind = "prompt"
+)
+
+// Source is where the password of a data source comes from. It's written as
+// kind:value, e.g. env:PROD_PASSWORD, file:/run/secrets/db, cmd:pass show db,
+// mycnf, pgpass:/path/to/pgpass or prompt.
+type Source struct {
+	Kind  Kind
+	Value string
+}
+
+func ParseSource(s string) (source Source, err error) {
+	kind, value, _ := strings.Cut(s, ":")
+	source = Source{Kind: Kind(kind), Value: value}
+	switch source.Kind {
+	case Env, File, Command:
+		if value == "" {
+			return source, fmt.Errorf("password source %s needs a value, e.g. %s:...", kind, kind)
+		}
+	case MyCnf, PgPass, Prompt:
+	default:
+		return source, fmt.Errorf("unknown password source %q, expected env, file, cmd, mycnf, pgpass or prompt", kind)
+	}
+	return
+}
+
+func (s Source) String() string {
+	if s.Value == "" {
+		return string(s.Kind)
+	}
+	return string(s.Kind) + ":" + s.Value
+}
+
+// Password reads the password of the data source.
+func (s Source) Password(ctx context.Context, cfg dbdsn.DataSourceConfig) (password string, err error) {
+	switch s.Kind {
+	case Env:
+		password, ok := os.LookupEnv(s.Value)
+		if !ok {
+			return "", fmt.Errorf("password environment variable %s isn't set", s.Value)
+		}
+		return password, nil
+	case File:
+		b, err := os.ReadFile(s.Value)
+		if err != nil {
+			return "", fmt.Errorf("failed to read password file:\n%w", err)
+		}
+		return trimNewline(string(b)), nil
+	case Command:
+		return runCommand(ctx, s.Value)
+	case MyCnf:
+		path, err := defaultPath(s.Value, "", ".my.cnf")
+		if err != nil {
+			return "", err
+		}
+		return myCnfPassword(path)
+	case PgPass:
+		path, err := defaultPath(s.Value, os.Getenv("PGPASSFILE"), ".pgpass")
+		if err != nil {
+			return "", err
+		}
+		return pgPassPassword(path, cfg)
+	}
+	return "", fmt.Errorf("password source %s can't be read", s.Kind)
+}
+
+func trimNewline(s string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+}
+
+func runCommand(ctx context.Context, command string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// the command isn't included since it may contain secrets
+		return "", fmt.Errorf("password command failed:\n%w", err)
+	}
+	return trimNewline(string(out)), nil
+}
+
+// defaultPath returns path, or env, or name in the home directory.
+func defaultPath(path, env, name string) (string, error) {
+	if path == "" {
+		path = env
+	}
+	if path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the home directory:\n%w", err)
+	}
+	return filepath.Join(home, name), nil
+}
+
+// myCnfPassword reads the password of the [client] and [mysql] sections, the
+// last one wins like it does for the mysql client.
+func myCnfPassword(path string) (password string, err error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read MySQL option file:\n%w", err)
+	}
+	found := false
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+			continue
+		case line[0] == '[' && line[len(line)-1] == ']':
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != "client" && section != "mysql" {
+			continue
+		}
+		key, value, _ := strings.Cut(line, "=")
+		if strings.TrimSpace(key) != "password" {
+			continue
+		}
+		password, found = unquote(strings.TrimSpace(value)), true
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if !found {
+		return "", fmt.Errorf("no password in the [client] or [mysql] section of %s", path)
+	}
+	return
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		if value[0] == '"' {
+			if s, err := strconv.Unquote(value); err == nil {
+				return s
+			}
+		}
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// pgPassPassword returns the password of the first line of a pgpass file that
+// matches the data source, as hostname:port:database:username:password where
+// every field but the password may be *.
+func pgPassPassword(path string, cfg dbdsn.DataSourceConfig) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file:\n%w", err)
+	}
+	host, port, user := cfg.Host, "5432", cfg.User
+	if host == "" {
+		host = "localhost"
+	}
+	if cfg.Port != 0 {
+		port = strconv.Itoa(cfg.Port)
+	}
+	if user == "" {
+		user = os.Getenv("USER")
+	}
+	want := []string{host, port, cfg.Database, user}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		fields := splitPgPass(line)
+		if len(fields) != 5 {
+			continue
+		}
+		matches := true
+		for i, w := range want {
+			if fields[i] != "*" && fields[i] != w {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return fields[4], nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("no matching line in " + path)
+}
+
+// splitPgPass splits a pgpass line on the colons that aren't escaped by a
+// backslash.
+func splitPgPass(line string) (fields []string) {
+	var field strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && i+1 < len(line):
+			i++
+			field.WriteByte(line[i])
+		case c == ':':
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(c)
+		}
+	}
+	return append(fields, field.String())
+}
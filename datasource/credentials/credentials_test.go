@@ -0,0 +1,66 @@
+package credentials
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dbdsn "sqlcmp/datasource/dsn"
+)
+
+func TestPassword(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	t.Setenv("SQLCMP_TEST_PASSWORD", "from env")
+	secret := write("secret", "from file\n")
+	myCnf := write("my.cnf", "[mysqldump]\npassword=dump\n\n[client]\nuser = app\npassword = \"from \\\"mycnf\\\"\"\n")
+	pgPass := write("pgpass", "# comment\nother:5432:*:app:wrong\ndb.example.com:*:app:app:from\\:pgpass\n*:*:*:*:fallback\n")
+	cfg := dbdsn.DataSourceConfig{Driver: "postgres", Host: "db.example.com", Port: 6432, Database: "app", User: "app"}
+
+	cases := map[string]string{
+		"env:SQLCMP_TEST_PASSWORD": "from env",
+		"file:" + secret:           "from file",
+		"cmd:printf 'from cmd\\n'": "from cmd",
+		"mycnf:" + myCnf:           `from "mycnf"`,
+		"pgpass:" + pgPass:         "from:pgpass",
+	}
+	for s, expected := range cases {
+		source, err := ParseSource(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		password, err := source.Password(context.Background(), cfg)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+		} else if password != expected {
+			t.Errorf("%s: expected %q, got %q", s, expected, password)
+		}
+	}
+
+	cfg.Database = "other"
+	source := Source{Kind: PgPass, Value: pgPass}
+	if password, err := source.Password(context.Background(), cfg); err != nil || password != "fallback" {
+		t.Errorf("expected the wildcard line to match, got %q, %v", password, err)
+	}
+	for _, s := range []string{"env:SQLCMP_TEST_UNSET", "cmd:exit 1", "file:" + filepath.Join(dir, "missing")} {
+		source, err := ParseSource(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := source.Password(context.Background(), cfg); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+	for _, s := range []string{"vault", "env", "file:"} {
+		if _, err := ParseSource(s); err == nil {
+			t.Errorf("%s: expected an invalid source", s)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package datasource
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 
@@ -15,6 +16,11 @@ type DataSource interface {
 	GetTableNames() (tables []string, err error)
 	GetSchema(tables []string) (schema []schema.Table, err error)
 	TableIterator(table string, columns, orderBy []string) (iterator schema.RecordIterator, err error)
+	// The Context variants stop their queries when ctx is done. Iterators are
+	// closed by the driver once ctx is done and report ctx.Err() from Err.
+	GetTableNamesContext(ctx context.Context) (tables []string, err error)
+	GetSchemaContext(ctx context.Context, tables []string) (schema []schema.Table, err error)
+	TableIteratorContext(ctx context.Context, table string, columns, orderBy []string) (iterator schema.RecordIterator, err error)
 	Close() (err error)
 }
 
@@ -30,7 +36,7 @@ func RegisterSource(driver string, source OpenFunc) {
 func OpenDSN(dsn string) (source DataSource, err error) {
 	cfg, err := dbdsn.Parse(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("Invalid dsn: %s\n%w", dsn, err)
+		return nil, fmt.Errorf("Invalid dsn: %s\n%w", dbdsn.Redact(dsn), err)
 	}
 
 	return Open(cfg)
@@ -43,3 +49,44 @@ func Open(cfg dbdsn.DataSourceConfig) (source DataSource, err error) {
 	}
 	return opener(cfg)
 }
+
+// Snapshotter is implemented by data sources that can read from a consistent
+// snapshot, so rows written during a comparison don't show up as differences.
+type Snapshotter interface {
+	// Snapshot starts a read-only transaction that every following read of the
+	// source goes through until it's closed, so they can't run concurrently. It
+	// returns the point in time of the snapshot, e.g. a timestamp or GTID set.
+	Snapshot(ctx context.Context) (position string, err error)
+}
+
+// Querier runs the reads of a source, it's either the *sql.DB of the source or
+// the connection of its snapshot.
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// BeginSnapshot takes a connection from db and runs the statements that start
+// the snapshot transaction on it.
+func BeginSnapshot(ctx context.Context, db *sql.DB, statements ...string) (conn *sql.Conn, err error) {
+	if conn, err = db.Conn(ctx); err != nil {
+		return
+	}
+	for _, statement := range statements {
+		if _, err = conn.ExecContext(ctx, statement); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return
+}
+
+// EndSnapshot ends the transaction of a snapshot and returns its connection to
+// the pool.
+func EndSnapshot(conn *sql.Conn) error {
+	_, err := conn.ExecContext(context.Background(), "ROLLBACK")
+	if closeErr := conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,217 @@
+package dialect
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"sqlcmp/datasource/schema"
+)
+
+// portableColumn is the type, default and auto increment of a column without
+// the syntax of a database.
+type portableColumn struct {
+	// typ is one of smallint, integer, bigint, decimal, real, double, boolean,
+	// char, varchar, text, date, time, datetime, timestamptz, binary, json and
+	// uuid
+	typ string
+	// size is the length or precision of the type and scale its scale, -1 when
+	// they aren't given
+	size, scale int
+	// def is the default, nil for none. It's a literal value, true and false
+	// for booleans, unless defExpr is set and it's one of the expressions of
+	// portableExprs.
+	def           *string
+	defExpr       bool
+	autoIncrement bool
+}
+
+var portableExprs = []string{"CURRENT_TIMESTAMP", "CURRENT_DATE", "CURRENT_TIME"}
+
+// converter is implemented by the dialects that can take part in Convert.
+type converter interface {
+	// database names the database so aliases of a driver convert to themselves
+	database() string
+	// portable returns the portable form of a column read from the database
+	portable(c schema.Column) (portableColumn, error)
+	// native returns the column with the type and default of p as the
+	// database's source reads them, so its dialect renders them
+	native(c schema.Column, p portableColumn) schema.Column
+	// primaryName returns the name the database gives the primary key of table
+	primaryName(table string) string
+}
+
+// Convert rewrites the column types, defaults and auto increments of tables
+// that were read from a source of the from driver into the form the to driver
+// reads them in, so the to dialect can create them. Tables are returned as
+// they are for the same database. Types, defaults and triggers without a
+// counterpart are an error rather than being written as they were read.
+func Convert(from, to string, tables []schema.Table) (converted []schema.Table, err error) {
+	fromDialect, err := Get(from)
+	if err != nil {
+		return
+	}
+	toDialect, err := Get(to)
+	if err != nil {
+		return
+	}
+	fromConv, fromOk := fromDialect.(converter)
+	toConv, toOk := toDialect.(converter)
+	if !fromOk || !toOk {
+		return nil, fmt.Errorf("can't convert the schema of %s to %s", from, to)
+	}
+	if fromConv.database() == toConv.database() {
+		return tables, nil
+	}
+	converted = make([]schema.Table, len(tables))
+	for i, t := range tables {
+		if len(t.Triggers) > 0 {
+			return nil, fmt.Errorf("trigger %s of table %s can't be converted from %s to %s", t.Triggers[0].Name, t.Name, from, to)
+		}
+		t.Columns = append([]schema.Column{}, t.Columns...)
+		for j, c := range t.Columns {
+			p, err := fromConv.portable(c)
+			if err != nil {
+				return nil, fmt.Errorf("column %s.%s can't be converted from %s to %s: %w", t.Name, c.Name, from, to, err)
+			}
+			t.Columns[j] = toConv.native(c, p)
+		}
+		t.Indices = append([]schema.Index{}, t.Indices...)
+		for j, idx := range t.Indices {
+			switch idx.Type = strings.ToUpper(idx.Type); idx.Type {
+			case "", "BTREE", "HASH":
+			default:
+				return nil, fmt.Errorf("%s index %s of table %s can't be converted from %s to %s", idx.Type, idx.Name, t.Name, from, to)
+			}
+			// only MySQL indexes prefixes of columns
+			if toConv.database() != "mysql" {
+				idx.Lengths = nil
+			}
+			// UNIQUE constraints are only told apart from indexes by Postgres
+			if toConv.database() != "postgres" {
+				idx.Constraint = false
+			}
+			if idx.Primary {
+				idx.Name = toConv.primaryName(t.Name)
+			}
+			t.Indices[j] = idx
+		}
+		converted[i] = t
+	}
+	return
+}
+
+// splitType returns the lower case name of a type without its arguments, e.g.
+// "int unsigned" for "int(10) unsigned", and its numeric arguments.
+func splitType(t string) (name string, args []int, err error) {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if open := strings.Index(t, "("); open >= 0 {
+		end := strings.Index(t[open:], ")")
+		if end < 0 {
+			return "", nil, fmt.Errorf("invalid type %s", t)
+		}
+		for _, arg := range strings.Split(t[open+1:open+end], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(arg))
+			if err != nil {
+				return "", nil, fmt.Errorf("type %s has no counterpart", t)
+			}
+			args = append(args, n)
+		}
+		t = t[:open] + " " + t[open+end+1:]
+	}
+	return strings.Join(strings.Fields(t), " "), args, nil
+}
+
+// sized returns a portable column of the type with the size and scale of args.
+func sized(typ string, args []int) portableColumn {
+	p := portableColumn{typ: typ, size: -1, scale: -1}
+	if len(args) > 0 {
+		p.size = args[0]
+	}
+	if len(args) > 1 {
+		p.scale = args[1]
+	}
+	return p
+}
+
+// withArgs appends the size and scale of p to the name of a type.
+func (p portableColumn) withArgs(name string) string {
+	switch {
+	case p.size < 0:
+		return name
+	case p.scale < 0:
+		return fmt.Sprintf("%s(%d)", name, p.size)
+	}
+	return fmt.Sprintf("%s(%d,%d)", name, p.size, p.scale)
+}
+
+// isNumber reports whether values of the type are written as bare numbers.
+func (p portableColumn) isNumber() bool {
+	switch p.typ {
+	case "smallint", "integer", "bigint", "decimal", "real", "double":
+		return true
+	}
+	return false
+}
+
+// literalDefault sets a literal default, turning the boolean literals of the
+// databases into true and false.
+func (p *portableColumn) literalDefault(value string) error {
+	if p.typ == "boolean" {
+		switch strings.ToLower(value) {
+		case "1", "true", "'1'", "b'1'":
+			value = "true"
+		case "0", "false", "'0'", "b'0'":
+			value = "false"
+		default:
+			return fmt.Errorf("invalid boolean default %s", value)
+		}
+	}
+	if p.isNumber() && !numberPattern.MatchString(value) {
+		return fmt.Errorf("invalid %s default %s", p.typ, value)
+	}
+	p.def = &value
+	return nil
+}
+
+// exprDefault sets a default expression that has a counterpart everywhere.
+func (p *portableColumn) exprDefault(expr string) error {
+	upper := strings.ToUpper(strings.TrimSpace(expr))
+	switch {
+	case upper == "NOW()" || upper == "TRANSACTION_TIMESTAMP()" || strings.HasPrefix(upper, "CURRENT_TIMESTAMP"):
+		upper = "CURRENT_TIMESTAMP"
+	case upper == "CURDATE()":
+		upper = "CURRENT_DATE"
+	case upper == "CURTIME()":
+		upper = "CURRENT_TIME"
+	}
+	for _, e := range portableExprs {
+		if upper == e {
+			p.def, p.defExpr = &e, true
+			return nil
+		}
+	}
+	return fmt.Errorf("default %s has no counterpart", expr)
+}
+
+// unquote returns the value of a SQL string literal at the start of s and what
+// follows it.
+func unquote(s string) (value, rest string, ok bool) {
+	if !strings.HasPrefix(s, "'") {
+		return "", s, false
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != '\'' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '\'' {
+			b.WriteByte('\'')
+			i++
+			continue
+		}
+		return b.String(), s[i+1:], true
+	}
+	return "", s, false
+}
@@ -0,0 +1,210 @@
+package dialect
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"sqlcmp/datasource/schema"
+)
+
+// Dialect renders SQL statements for a specific database. Column types and
+// defaults are written as they were read, so tables of another kind of source
+// have to go through Convert first. Operations a database can't do in place
+// are returned as SQL comments.
+type Dialect interface {
+	QuoteIdent(name string) string
+	// QuoteValue returns the literal for a raw column value, nil being NULL
+	QuoteValue(value []byte) string
+	// Insert returns an INSERT of the quoted rows
+	Insert(table string, columns []string, rows [][]string) string
+	// Upsert returns an INSERT of the quoted rows that updates rows which
+	// already exist with the same key. The key needs a unique index.
+	Upsert(table string, columns []string, key []string, rows [][]string) string
+	CreateTable(table schema.Table) string
+	// InlineForeignKeys reports whether CreateTable declares the foreign keys
+	// of the table, instead of adding them with AddForeignKey
+	InlineForeignKeys() bool
+	DropTable(table string) string
+	AddColumn(table string, column schema.Column) string
+	// ModifyColumn returns the statements that turn column current into desired
+	ModifyColumn(table string, current, desired schema.Column) []string
+	DropColumn(table, column string) string
+	CreateIndex(table string, index schema.Index) string
+	DropIndex(table string, index schema.Index) string
+	AddForeignKey(table string, fk []schema.ForeignKey) string
+	DropForeignKey(table, name string) string
+	CreateTrigger(table string, trigger schema.Trigger) string
+	DropTrigger(table string, trigger schema.Trigger) string
+	// EndStatement terminates a statement for a SQL script that is run by the
+	// client of the database
+	EndStatement(stmt string) string
+}
+
+var dialects = map[string]Dialect{}
+
+func Register(driver string, dialect Dialect) {
+	if _, ok := dialects[driver]; ok {
+		panic("dialect already registered: " + driver)
+	}
+	dialects[driver] = dialect
+}
+
+func Get(driver string) (dialect Dialect, err error) {
+	dialect, ok := dialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("no dialect registered for driver: %s", driver)
+	}
+	return dialect, nil
+}
+
+// generic holds the statements that are the same for every database.
+type generic struct {
+	quote     string
+	columnDef func(c schema.Column) string
+}
+
+func (g generic) QuoteIdent(name string) string {
+	return g.quote + strings.ReplaceAll(name, g.quote, g.quote+g.quote) + g.quote
+}
+
+func (g generic) quoteIdents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = g.QuoteIdent(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func (g generic) CreateTable(table schema.Table) string {
+	lines := []string{}
+	for _, c := range table.Columns {
+		lines = append(lines, "  "+g.columnDef(c))
+	}
+	if pk := primaryKey(table); len(pk) > 0 {
+		lines = append(lines, "  PRIMARY KEY ("+g.quoteIdents(pk)+")")
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n%s\n)", g.QuoteIdent(table.Name), strings.Join(lines, ",\n"))
+}
+
+func (g generic) InlineForeignKeys() bool {
+	return false
+}
+
+func (g generic) DropTable(table string) string {
+	return "DROP TABLE " + g.QuoteIdent(table)
+}
+
+func (g generic) AddColumn(table string, column schema.Column) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", g.QuoteIdent(table), g.columnDef(column))
+}
+
+func (g generic) DropColumn(table, column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", g.QuoteIdent(table), g.QuoteIdent(column))
+}
+
+func (g generic) CreateIndex(table string, index schema.Index) string {
+	if index.Primary {
+		return fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", g.QuoteIdent(table), g.quoteIdents(index.Columns))
+	}
+	unique := ""
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, g.QuoteIdent(index.Name), g.QuoteIdent(table), g.quoteIdents(index.Columns))
+}
+
+func (g generic) DropIndex(table string, index schema.Index) string {
+	return "DROP INDEX " + g.QuoteIdent(index.Name)
+}
+
+func (g generic) AddForeignKey(table string, fk []schema.ForeignKey) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD %s", g.QuoteIdent(table), g.foreignKeyConstraint(fk))
+}
+
+func (g generic) foreignKeyConstraint(fk []schema.ForeignKey) string {
+	from, to := make([]string, len(fk)), make([]string, len(fk))
+	for i, col := range fk {
+		from[i], to[i] = col.FromColumn, col.ToColumn
+	}
+	return fmt.Sprintf("CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		g.QuoteIdent(fk[0].Name), g.quoteIdents(from), g.QuoteIdent(fk[0].To), g.quoteIdents(to))
+}
+
+func (g generic) DropForeignKey(table, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", g.QuoteIdent(table), g.QuoteIdent(name))
+}
+
+func (g generic) DropTrigger(table string, trigger schema.Trigger) string {
+	return "DROP TRIGGER " + g.QuoteIdent(trigger.Name)
+}
+
+func (g generic) EndStatement(stmt string) string {
+	return stmt + ";"
+}
+
+// values returns the VALUES list of an INSERT.
+func values(rows [][]string) string {
+	tuples := make([]string, len(rows))
+	for i, row := range rows {
+		tuples[i] = "(" + strings.Join(row, ", ") + ")"
+	}
+	return strings.Join(tuples, ",\n  ")
+}
+
+// quoteString quotes valid UTF-8 text as a string literal and anything else
+// with the given hex literal format.
+func quoteString(value []byte, escapeBackslash bool, hexFormat string) string {
+	if !utf8.Valid(value) || bytes.IndexByte(value, 0) >= 0 {
+		return fmt.Sprintf(hexFormat, hex.EncodeToString(value))
+	}
+	s := strings.ReplaceAll(string(value), "'", "''")
+	if escapeBackslash {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + s + "'"
+}
+
+func (g generic) Insert(table string, columns []string, rows [][]string) string {
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES\n  %s", g.QuoteIdent(table), g.quoteIdents(columns), values(rows))
+}
+
+// upsert returns an INSERT for the dialects that support ON CONFLICT.
+func (g generic) upsert(table string, columns []string, key []string, rows [][]string) string {
+	updates := []string{}
+	for _, col := range columns {
+		if !slices.Contains(key, col) {
+			updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", g.QuoteIdent(col), g.QuoteIdent(col)))
+		}
+	}
+	conflict := "DO NOTHING"
+	if len(updates) > 0 {
+		conflict = "DO UPDATE SET " + strings.Join(updates, ", ")
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES\n  %s\nON CONFLICT (%s) %s",
+		g.QuoteIdent(table), g.quoteIdents(columns), values(rows), g.quoteIdents(key), conflict)
+}
+
+// primaryKey returns the primary key columns in index order when the index is
+// known and in column order otherwise.
+func primaryKey(table schema.Table) (columns []string) {
+	for _, idx := range table.Indices {
+		if idx.Primary {
+			return idx.Columns
+		}
+	}
+	for _, c := range table.Columns {
+		if c.IsPrimary {
+			columns = append(columns, c.Name)
+		}
+	}
+	return
+}
+
+// comment returns a SQL comment for an operation that has to be done by hand.
+func comment(format string, args ...interface{}) string {
+	return "-- " + fmt.Sprintf(format, args...)
+}
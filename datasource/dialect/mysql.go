@@ -0,0 +1,246 @@
+package dialect
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"sqlcmp/datasource/schema"
+)
+
+func init() {
+	Register("mysql", newMySQL())
+}
+
+type mysql struct {
+	generic
+}
+
+func newMySQL() mysql {
+	m := mysql{generic{quote: "`"}}
+	m.columnDef = m.columnDefinition
+	return m
+}
+
+var numberPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// columnDefinition renders a column as read by SHOW COLUMNS, where defaults
+// are unquoted values unless they're flagged as expressions.
+func (m mysql) columnDefinition(c schema.Column) string {
+	parts := []string{m.QuoteIdent(c.Name), c.Type}
+	if !c.IsNullable {
+		parts = append(parts, "NOT NULL")
+	}
+	extra := strings.TrimSpace(strings.Replace(c.Extra, "DEFAULT_GENERATED", "", 1))
+	switch {
+	case c.Default == "":
+	case strings.Contains(c.Extra, "DEFAULT_GENERATED"):
+		upper := strings.ToUpper(c.Default)
+		if strings.HasPrefix(upper, "CURRENT_TIMESTAMP") || strings.HasPrefix(upper, "NOW(") {
+			parts = append(parts, "DEFAULT "+c.Default)
+		} else {
+			parts = append(parts, "DEFAULT ("+c.Default+")")
+		}
+	case numberPattern.MatchString(c.Default):
+		parts = append(parts, "DEFAULT "+c.Default)
+	default:
+		parts = append(parts, "DEFAULT '"+strings.ReplaceAll(c.Default, "'", "''")+"'")
+	}
+	if extra != "" {
+		parts = append(parts, extra)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (m mysql) QuoteValue(value []byte) string {
+	if value == nil {
+		return "NULL"
+	}
+	return quoteString(value, true, "X'%s'")
+}
+
+func (m mysql) Upsert(table string, columns []string, key []string, rows [][]string) string {
+	updates := []string{}
+	for _, col := range columns {
+		if !slices.Contains(key, col) {
+			updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", m.QuoteIdent(col), m.QuoteIdent(col)))
+		}
+	}
+	// a no-op update keeps the insert from failing when every column is in the key
+	if len(updates) == 0 {
+		updates = append(updates, fmt.Sprintf("%s = %s", m.QuoteIdent(key[0]), m.QuoteIdent(key[0])))
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES\n  %s\nON DUPLICATE KEY UPDATE %s",
+		m.QuoteIdent(table), m.quoteIdents(columns), values(rows), strings.Join(updates, ", "))
+}
+
+func (m mysql) ModifyColumn(table string, current, desired schema.Column) []string {
+	return []string{fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s", m.QuoteIdent(table), m.columnDefinition(desired))}
+}
+
+func (m mysql) CreateIndex(table string, index schema.Index) string {
+	if index.Primary {
+		return m.generic.CreateIndex(table, index)
+	}
+	cols := make([]string, len(index.Columns))
+	for i, col := range index.Columns {
+		cols[i] = m.QuoteIdent(col)
+		if i < len(index.Lengths) && index.Lengths[i] > 0 {
+			cols[i] += fmt.Sprintf("(%d)", index.Lengths[i])
+		}
+	}
+	kind := ""
+	switch {
+	case index.Unique:
+		kind = "UNIQUE "
+	case index.Type == "FULLTEXT" || index.Type == "SPATIAL":
+		kind = index.Type + " "
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", kind, m.QuoteIdent(index.Name), m.QuoteIdent(table), strings.Join(cols, ", "))
+}
+
+func (m mysql) DropIndex(table string, index schema.Index) string {
+	if index.Primary {
+		return fmt.Sprintf("ALTER TABLE %s DROP PRIMARY KEY", m.QuoteIdent(table))
+	}
+	return fmt.Sprintf("DROP INDEX %s ON %s", m.QuoteIdent(index.Name), m.QuoteIdent(table))
+}
+
+func (m mysql) DropForeignKey(table, name string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", m.QuoteIdent(table), m.QuoteIdent(name))
+}
+
+// CreateTrigger wraps the trigger body since MySQL only stores the action
+// statement.
+func (m mysql) CreateTrigger(table string, trigger schema.Trigger) string {
+	return fmt.Sprintf("CREATE TRIGGER %s %s %s ON %s FOR EACH ROW %s", m.QuoteIdent(trigger.Name), trigger.Timing, trigger.Event, m.QuoteIdent(table), trigger.SQL)
+}
+
+// EndStatement changes the delimiter of the mysql client around statements
+// that hold a semicolon, like a trigger with a BEGIN ... END body, so they
+// aren't cut off at the first inner statement.
+func (m mysql) EndStatement(stmt string) string {
+	if !strings.Contains(stmt, ";") {
+		return stmt + ";"
+	}
+	return "DELIMITER //\n" + stmt + " //\nDELIMITER ;"
+}
+
+func (m mysql) database() string {
+	return "mysql"
+}
+
+// portable reads a column of SHOW COLUMNS, where tinyint(1) is the boolean
+// type and unsigned integers widen to the next larger type.
+func (m mysql) portable(c schema.Column) (p portableColumn, err error) {
+	name, args, err := splitType(c.Type)
+	if err != nil {
+		return
+	}
+	unsigned := strings.HasSuffix(name, " unsigned") || strings.HasSuffix(name, " unsigned zerofill")
+	name, _, _ = strings.Cut(name, " ")
+	switch {
+	case (name == "tinyint" || name == "bit") && len(args) == 1 && args[0] == 1:
+		p = sized("boolean", nil)
+	case name == "tinyint" || name == "year" || name == "smallint" && !unsigned:
+		p = sized("smallint", nil)
+	case name == "smallint" || name == "mediumint" || name == "int" && !unsigned:
+		p = sized("integer", nil)
+	case name == "int" || name == "bigint" && !unsigned:
+		p = sized("bigint", nil)
+	case name == "bigint":
+		p = sized("decimal", []int{20, 0})
+	case name == "decimal" || name == "numeric":
+		p = sized("decimal", args)
+	case name == "float":
+		p = sized("real", nil)
+	case name == "double" || name == "real":
+		p = sized("double", nil)
+	case name == "char" || name == "varchar":
+		p = sized(name, args)
+	case strings.HasSuffix(name, "text"):
+		p = sized("text", nil)
+	case name == "binary" || name == "varbinary":
+		p = sized("binary", args)
+	case strings.HasSuffix(name, "blob"):
+		p = sized("binary", nil)
+	case name == "date" || name == "time" || name == "datetime" || name == "json":
+		p = sized(name, nil)
+	case name == "timestamp":
+		p = sized("timestamptz", nil)
+	default:
+		return p, fmt.Errorf("type %s has no counterpart", c.Type)
+	}
+	extra := strings.ToLower(c.Extra)
+	if strings.Contains(extra, "generated") && !strings.Contains(extra, "default_generated") || strings.Contains(extra, "on update") {
+		return p, fmt.Errorf("%s has no counterpart", c.Extra)
+	}
+	p.autoIncrement = c.IsAutoIncrement
+	switch {
+	case c.Default == "":
+	case strings.Contains(extra, "default_generated"):
+		err = p.exprDefault(c.Default)
+	case p.typ == "datetime" || p.typ == "timestamptz":
+		if strings.HasPrefix(strings.ToUpper(c.Default), "CURRENT_TIMESTAMP") {
+			err = p.exprDefault(c.Default)
+		} else {
+			err = p.literalDefault(c.Default)
+		}
+	default:
+		err = p.literalDefault(c.Default)
+	}
+	return
+}
+
+// native writes the type and default of p the way SHOW COLUMNS reads them.
+func (m mysql) native(c schema.Column, p portableColumn) schema.Column {
+	switch p.typ {
+	case "smallint", "bigint", "double", "date", "time", "datetime", "json":
+		c.Type = p.typ
+	case "integer":
+		c.Type = "int"
+	case "real":
+		c.Type = "float"
+	case "decimal", "char":
+		c.Type = p.withArgs(p.typ)
+	case "boolean":
+		c.Type = "tinyint(1)"
+	case "varchar":
+		c.Type = "longtext"
+		if p.size >= 0 {
+			c.Type = p.withArgs("varchar")
+		}
+	case "text":
+		c.Type = "longtext"
+	case "binary":
+		c.Type = "longblob"
+		if p.size >= 0 {
+			c.Type = p.withArgs("varbinary")
+		}
+	case "timestamptz":
+		c.Type = "timestamp"
+	case "uuid":
+		c.Type = "char(36)"
+	}
+	c.IsAutoIncrement, c.Extra, c.Default = p.autoIncrement, "", ""
+	if p.autoIncrement {
+		c.Extra = "auto_increment"
+	}
+	switch {
+	case p.def == nil:
+	case p.defExpr:
+		c.Default, c.Extra = *p.def, "DEFAULT_GENERATED"
+	case p.typ == "boolean" && *p.def == "true":
+		c.Default = "1"
+	case p.typ == "boolean":
+		c.Default = "0"
+	default:
+		c.Default = *p.def
+	}
+	return c
+}
+
+func (m mysql) primaryName(table string) string {
+	return "PRIMARY"
+}
@@ -0,0 +1,216 @@
+package dialect
+
+import (
+	"fmt"
+	"strings"
+
+	"sqlcmp/datasource/schema"
+)
+
+func init() {
+	p := newPostgres()
+	Register("postgres", p)
+	Register("postgresql", p)
+}
+
+type postgres struct {
+	generic
+}
+
+func newPostgres() postgres {
+	p := postgres{generic{quote: `"`}}
+	p.columnDef = p.columnDefinition
+	return p
+}
+
+// columnDefinition renders a column as read from pg_catalog, where defaults
+// are already SQL expressions.
+func (p postgres) columnDefinition(c schema.Column) string {
+	parts := []string{p.QuoteIdent(c.Name), c.Type}
+	if !c.IsNullable {
+		parts = append(parts, "NOT NULL")
+	}
+	if c.Default != "" {
+		parts = append(parts, "DEFAULT "+c.Default)
+	}
+	if strings.HasPrefix(c.Extra, "generated") {
+		parts = append(parts, strings.ToUpper(c.Extra))
+	}
+	return strings.Join(parts, " ")
+}
+
+// QuoteValue relies on standard_conforming_strings, which is on by default.
+// Binary values are written in the bytea hex format.
+func (p postgres) QuoteValue(value []byte) string {
+	if value == nil {
+		return "NULL"
+	}
+	return quoteString(value, false, `'\x%s'`)
+}
+
+func (p postgres) Upsert(table string, columns []string, key []string, rows [][]string) string {
+	return p.upsert(table, columns, key, rows)
+}
+
+func (p postgres) ModifyColumn(table string, current, desired schema.Column) (stmts []string) {
+	alter := fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s ", p.QuoteIdent(table), p.QuoteIdent(desired.Name))
+	if !strings.EqualFold(current.Type, desired.Type) {
+		stmts = append(stmts, alter+"TYPE "+desired.Type)
+	}
+	if current.IsNullable != desired.IsNullable {
+		if desired.IsNullable {
+			stmts = append(stmts, alter+"DROP NOT NULL")
+		} else {
+			stmts = append(stmts, alter+"SET NOT NULL")
+		}
+	}
+	if current.Default != desired.Default {
+		if desired.Default == "" {
+			stmts = append(stmts, alter+"DROP DEFAULT")
+		} else {
+			stmts = append(stmts, alter+"SET DEFAULT "+desired.Default)
+		}
+	}
+	if current.Extra != desired.Extra {
+		switch {
+		case strings.HasPrefix(desired.Extra, "generated"):
+			if strings.HasPrefix(current.Extra, "generated") {
+				stmts = append(stmts, alter+"DROP IDENTITY")
+			}
+			stmts = append(stmts, alter+"ADD "+strings.ToUpper(desired.Extra))
+		case strings.HasPrefix(current.Extra, "generated"):
+			stmts = append(stmts, alter+"DROP IDENTITY")
+		}
+	}
+	return
+}
+
+func (p postgres) CreateIndex(table string, index schema.Index) string {
+	if index.Primary {
+		return fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s PRIMARY KEY (%s)", p.QuoteIdent(table), p.QuoteIdent(index.Name), p.quoteIdents(index.Columns))
+	}
+	if index.Unique && index.Constraint {
+		return fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s UNIQUE (%s)", p.QuoteIdent(table), p.QuoteIdent(index.Name), p.quoteIdents(index.Columns))
+	}
+	unique := ""
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+	using := ""
+	if index.Type != "" && index.Type != "BTREE" {
+		using = " USING " + strings.ToLower(index.Type)
+	}
+	return fmt.Sprintf("CREATE %sINDEX %s ON %s%s (%s)", unique, p.QuoteIdent(index.Name), p.QuoteIdent(table), using, p.quoteIdents(index.Columns))
+}
+
+// DropIndex drops the constraint of indexes that belong to one, as Postgres
+// refuses to drop them directly.
+func (p postgres) DropIndex(table string, index schema.Index) string {
+	if index.Primary || index.Constraint {
+		return p.DropForeignKey(table, index.Name)
+	}
+	return p.generic.DropIndex(table, index)
+}
+
+// CreateTrigger uses the definition returned by pg_get_triggerdef.
+func (p postgres) CreateTrigger(table string, trigger schema.Trigger) string {
+	return trigger.SQL
+}
+
+func (p postgres) DropTrigger(table string, trigger schema.Trigger) string {
+	return fmt.Sprintf("DROP TRIGGER %s ON %s", p.QuoteIdent(trigger.Name), p.QuoteIdent(table))
+}
+
+func (p postgres) database() string {
+	return "postgres"
+}
+
+// portable reads a column of format_type, where serial columns default to
+// nextval and literal defaults are cast to the column type.
+func (p postgres) portable(c schema.Column) (pc portableColumn, err error) {
+	name, args, err := splitType(c.Type)
+	if err != nil {
+		return
+	}
+	switch name {
+	case "smallint", "integer", "bigint", "real", "boolean", "text", "date", "json", "uuid":
+		pc = sized(name, nil)
+	case "numeric":
+		pc = sized("decimal", args)
+	case "double precision":
+		pc = sized("double", nil)
+	case "character", "bpchar":
+		pc = sized("char", args)
+	case "character varying":
+		pc = sized("varchar", args)
+	case "time without time zone":
+		pc = sized("time", nil)
+	case "timestamp without time zone":
+		pc = sized("datetime", nil)
+	case "timestamp with time zone":
+		pc = sized("timestamptz", nil)
+	case "bytea":
+		pc = sized("binary", nil)
+	case "jsonb":
+		pc = sized("json", nil)
+	default:
+		return pc, fmt.Errorf("type %s has no counterpart", c.Type)
+	}
+	pc.autoIncrement = c.IsAutoIncrement
+	def := c.Default
+	for strings.HasPrefix(def, "(") && strings.HasSuffix(def, ")") {
+		def = def[1 : len(def)-1]
+	}
+	value, rest, quoted := unquote(def)
+	switch {
+	case def == "" || strings.HasPrefix(def, "nextval(") || strings.HasPrefix(strings.ToUpper(def), "NULL"):
+	case quoted && (rest == "" || strings.HasPrefix(rest, "::")):
+		err = pc.literalDefault(value)
+	case numberPattern.MatchString(def) || def == "true" || def == "false":
+		err = pc.literalDefault(def)
+	default:
+		err = pc.exprDefault(def)
+	}
+	return
+}
+
+// native writes the type and default of pc the way format_type and
+// pg_get_expr read them.
+func (p postgres) native(c schema.Column, pc portableColumn) schema.Column {
+	switch pc.typ {
+	case "smallint", "integer", "bigint", "real", "boolean", "text", "date", "json", "uuid":
+		c.Type = pc.typ
+	case "decimal":
+		c.Type = pc.withArgs("numeric")
+	case "double":
+		c.Type = "double precision"
+	case "char":
+		c.Type = pc.withArgs("character")
+	case "varchar":
+		c.Type = pc.withArgs("character varying")
+	case "time":
+		c.Type = "time without time zone"
+	case "datetime":
+		c.Type = "timestamp without time zone"
+	case "timestamptz":
+		c.Type = "timestamp with time zone"
+	case "binary":
+		c.Type = "bytea"
+	}
+	c.IsAutoIncrement, c.Extra, c.Default = pc.autoIncrement, "", ""
+	switch {
+	case pc.autoIncrement:
+		c.Extra = "generated by default as identity"
+	case pc.def == nil:
+	case pc.defExpr || pc.isNumber() || pc.typ == "boolean":
+		c.Default = *pc.def
+	default:
+		name, _, _ := strings.Cut(c.Type, "(")
+		c.Default = "'" + strings.ReplaceAll(*pc.def, "'", "''") + "'::" + name
+	}
+	return c
+}
+
+func (p postgres) primaryName(table string) string {
+	return table + "_pkey"
+}
@@ -0,0 +1,204 @@
+package dialect
+
+import (
+	"fmt"
+	"strings"
+
+	"sqlcmp/datasource/schema"
+)
+
+func init() {
+	Register("sqlite3", newSQLite())
+}
+
+// sqlite can't alter columns or constraints of an existing table, so those
+// changes are returned as comments and need a table rebuild.
+type sqlite struct {
+	generic
+}
+
+func newSQLite() sqlite {
+	s := sqlite{generic{quote: `"`}}
+	s.columnDef = s.columnDefinition
+	return s
+}
+
+func (s sqlite) columnDefinition(c schema.Column) string {
+	parts := []string{s.QuoteIdent(c.Name)}
+	if c.Type != "" {
+		parts = append(parts, c.Type)
+	}
+	if c.IsAutoIncrement {
+		parts = append(parts, "PRIMARY KEY AUTOINCREMENT")
+	} else if !c.IsNullable {
+		parts = append(parts, "NOT NULL")
+	}
+	if c.Default != "" {
+		parts = append(parts, "DEFAULT "+c.Default)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s sqlite) CreateTable(table schema.Table) string {
+	lines := []string{}
+	inlinePk := false
+	for _, c := range table.Columns {
+		lines = append(lines, "  "+s.columnDefinition(c))
+		// the primary key is declared on the column itself
+		inlinePk = inlinePk || c.IsAutoIncrement
+	}
+	if pk := primaryKey(table); len(pk) > 0 && !inlinePk {
+		lines = append(lines, "  PRIMARY KEY ("+s.quoteIdents(pk)+")")
+	}
+	names, groups := schema.GroupForeignKeys(table.ForeignKeys)
+	for _, name := range names {
+		lines = append(lines, "  "+s.foreignKeyConstraint(groups[name]))
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n%s\n)", s.QuoteIdent(table.Name), strings.Join(lines, ",\n"))
+}
+
+func (s sqlite) InlineForeignKeys() bool {
+	return true
+}
+
+func (s sqlite) QuoteValue(value []byte) string {
+	if value == nil {
+		return "NULL"
+	}
+	return quoteString(value, false, "X'%s'")
+}
+
+func (s sqlite) Upsert(table string, columns []string, key []string, rows [][]string) string {
+	return s.upsert(table, columns, key, rows)
+}
+
+func (s sqlite) ModifyColumn(table string, current, desired schema.Column) []string {
+	return []string{comment("sqlite can't modify column %s.%s to %s, the table has to be rebuilt", table, desired.Name, s.columnDefinition(desired))}
+}
+
+func (s sqlite) CreateIndex(table string, index schema.Index) string {
+	if index.Primary || strings.HasPrefix(index.Name, "sqlite_autoindex_") {
+		return comment("sqlite can't add constraint %s (%s) to %s, the table has to be rebuilt", index.Name, strings.Join(index.Columns, ", "), table)
+	}
+	return s.generic.CreateIndex(table, index)
+}
+
+func (s sqlite) DropIndex(table string, index schema.Index) string {
+	if index.Primary || strings.HasPrefix(index.Name, "sqlite_autoindex_") {
+		return comment("sqlite can't drop constraint %s from %s, the table has to be rebuilt", index.Name, table)
+	}
+	return s.generic.DropIndex(table, index)
+}
+
+func (s sqlite) AddForeignKey(table string, fk []schema.ForeignKey) string {
+	return comment("sqlite can't add foreign key %s to %s, the table has to be rebuilt", fk[0].Name, table)
+}
+
+func (s sqlite) DropForeignKey(table, name string) string {
+	return comment("sqlite can't drop foreign key %s from %s, the table has to be rebuilt", name, table)
+}
+
+// CreateTrigger uses the CREATE TRIGGER statement stored in sqlite_master.
+func (s sqlite) CreateTrigger(table string, trigger schema.Trigger) string {
+	return trigger.SQL
+}
+
+func (s sqlite) database() string {
+	return "sqlite3"
+}
+
+// portable reads a declared column type by its name and falls back to the
+// type affinity sqlite gives names it doesn't know.
+func (s sqlite) portable(c schema.Column) (p portableColumn, err error) {
+	name, args, err := splitType(c.Type)
+	if err != nil {
+		return
+	}
+	switch name {
+	case "integer", "bigint", "int8", "unsigned big int":
+		p = sized("bigint", nil)
+	case "int", "int4", "mediumint":
+		p = sized("integer", nil)
+	case "smallint", "int2", "tinyint":
+		p = sized("smallint", nil)
+	case "boolean", "bool":
+		p = sized("boolean", nil)
+	case "decimal", "numeric":
+		p = sized("decimal", args)
+	case "char", "character", "nchar", "native character":
+		p = sized("char", args)
+	case "varchar", "character varying", "varying character", "nvarchar":
+		p = sized("varchar", args)
+	case "date", "time", "datetime", "json", "uuid":
+		p = sized(name, nil)
+	case "timestamp":
+		p = sized("datetime", nil)
+	default:
+		switch {
+		case strings.Contains(name, "int"):
+			p = sized("bigint", nil)
+		case strings.Contains(name, "char") || strings.Contains(name, "clob") || strings.Contains(name, "text"):
+			p = sized("text", nil)
+		case strings.Contains(name, "blob"):
+			p = sized("binary", nil)
+		case strings.Contains(name, "real") || strings.Contains(name, "floa") || strings.Contains(name, "doub"):
+			p = sized("double", nil)
+		default:
+			return p, fmt.Errorf("type %q has no counterpart", c.Type)
+		}
+	}
+	p.autoIncrement = c.IsAutoIncrement
+	def := c.Default
+	for strings.HasPrefix(def, "(") && strings.HasSuffix(def, ")") {
+		def = def[1 : len(def)-1]
+	}
+	value, rest, quoted := unquote(def)
+	switch {
+	case def == "" || strings.EqualFold(def, "NULL"):
+	case quoted && rest == "":
+		err = p.literalDefault(value)
+	case numberPattern.MatchString(def) || strings.EqualFold(def, "TRUE") || strings.EqualFold(def, "FALSE"):
+		err = p.literalDefault(strings.ToLower(def))
+	default:
+		err = p.exprDefault(def)
+	}
+	return
+}
+
+// native writes the type and default of p as they are declared, with JSON and
+// UUID stored as TEXT so they keep the text affinity.
+func (s sqlite) native(c schema.Column, p portableColumn) schema.Column {
+	switch p.typ {
+	case "decimal", "char", "varchar":
+		c.Type = strings.ToUpper(p.withArgs(p.typ))
+	case "double":
+		c.Type = "REAL"
+	case "text", "json", "uuid":
+		c.Type = "TEXT"
+	case "binary":
+		c.Type = "BLOB"
+	case "timestamptz":
+		c.Type = "TIMESTAMP"
+	default:
+		c.Type = strings.ToUpper(p.typ)
+	}
+	c.IsAutoIncrement, c.Extra, c.Default = p.autoIncrement, "", ""
+	if p.autoIncrement {
+		// only an INTEGER PRIMARY KEY can be declared with AUTOINCREMENT
+		c.Type, c.Extra = "INTEGER", "autoincrement"
+	}
+	switch {
+	case p.def == nil:
+	case p.defExpr || p.isNumber():
+		c.Default = *p.def
+	case p.typ == "boolean":
+		c.Default = strings.ToUpper(*p.def)
+	default:
+		c.Default = "'" + strings.ReplaceAll(*p.def, "'", "''") + "'"
+	}
+	return c
+}
+
+func (s sqlite) primaryName(table string) string {
+	return "sqlite_autoindex_" + table + "_1"
+}
@@ -0,0 +1,30 @@
+package dsn
+
+import (
+	"reflect"
+	"testing"
+)
+
+// FuzzParse checks that Parse doesn't panic and that every dsn it accepts
+// formats back into a dsn that parses into the same config.
+func FuzzParse(f *testing.F) {
+	for _, c := range dsnCases {
+		f.Add(c.dsn)
+	}
+	f.Add("mysql://u:p@tcp(h)/")
+	f.Add("postgres://u@[::1]/db?sslpassword=x&sslmode=require")
+	f.Fuzz(func(t *testing.T, dsn string) {
+		cfg, err := Parse(dsn)
+		if err != nil {
+			return
+		}
+		formatted := FormatDSN(cfg)
+		again, err := Parse(formatted)
+		if err != nil {
+			t.Fatalf("%q formatted as %q, which doesn't parse: %v", dsn, formatted, err)
+		}
+		if !reflect.DeepEqual(cfg, again) {
+			t.Fatalf("%q formatted as %q, which parses into %#v instead of %#v", dsn, formatted, again, cfg)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package mysql
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+
+	"sqlcmp/datasource/dsn"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Params of the dsn that configure TLS with files, the others are passed on to
+// the driver, e.g. tls, charset, parseTime, loc, timeout and readTimeout.
+const (
+	// tlsCAParam is a PEM file with the certificates of the CAs that are trusted
+	tlsCAParam = "tls-ca"
+	// tlsCertParam and tlsKeyParam are the PEM files of a client certificate
+	tlsCertParam = "tls-cert"
+	tlsKeyParam  = "tls-key"
+)
+
+// config maps a data source onto the config of the driver. The protocol is tcp
+// unless it's given, the address of unix is the path of the socket.
+func config(cfg dsn.DataSourceConfig) (*mysql.Config, error) {
+	params := url.Values{}
+	for k, v := range cfg.Params {
+		switch k {
+		case tlsCAParam, tlsCertParam, tlsKeyParam:
+		default:
+			params[k] = v
+		}
+	}
+	// the driver reads its params like it does in its own dsns
+	c, err := mysql.ParseDSN("/?" + params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("invalid mysql params:\n%w", err)
+	}
+	// the TLS config is derived again from the params for the real address
+	c.TLS = nil
+
+	c.User, c.Passwd, c.DBName = cfg.User, cfg.Password, cfg.Database
+	c.Net = cfg.Protocol
+	switch c.Net {
+	case "":
+		c.Net = "tcp"
+		fallthrough
+	case "tcp", "tcp4", "tcp6":
+		host, port := cfg.Host, cfg.Port
+		if host == "" {
+			host = "localhost"
+		}
+		if port == 0 {
+			port = 3306
+		}
+		c.Addr = net.JoinHostPort(host, strconv.Itoa(port))
+	default:
+		c.Addr = cfg.Host
+	}
+
+	if c.TLS, err = tlsConfig(cfg.Params, c.TLSConfig); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// tlsConfig builds a TLS config from the file params, or returns nil when
+// there are none. mode is the tls param.
+func tlsConfig(params url.Values, mode string) (config *tls.Config, err error) {
+	ca, cert, key := params.Get(tlsCAParam), params.Get(tlsCertParam), params.Get(tlsKeyParam)
+	if ca == "" && cert == "" && key == "" {
+		return nil, nil
+	}
+	switch mode {
+	case "", "true", "skip-verify", "preferred":
+	default:
+		return nil, fmt.Errorf("%s, %s and %s can't be used with tls=%s", tlsCAParam, tlsCertParam, tlsKeyParam, mode)
+	}
+	config = &tls.Config{InsecureSkipVerify: mode == "skip-verify"}
+	if ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS CA file:\n%w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in TLS CA file %s", ca)
+		}
+	}
+	if (cert == "") != (key == "") {
+		return nil, errors.New(tlsCertParam + " and " + tlsKeyParam + " have to be given together")
+	}
+	if cert != "" {
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS client certificate:\n%w", err)
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+	return config, nil
+}
@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -9,7 +10,7 @@ import (
 	"sqlcmp/datasource/dsn"
 	"sqlcmp/datasource/schema"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 type mysqlColumn struct {
@@ -29,25 +30,33 @@ type mysqlFk struct {
 	ReferencedColumnName string
 }
 
+type mysqlIndex struct {
+	IndexName  string
+	IndexType  string
+	NonUnique  bool
+	ColumnName *string
+	SubPart    *int
+}
+
 func init() {
 	db.RegisterSource("mysql", func(cfg dsn.DataSourceConfig) (source db.DataSource, err error) {
-		if cfg.Host == "" {
-			cfg.Host = "localhost"
-		}
-		if cfg.Port == 0 {
-			cfg.Port = 3306
-		}
-
-		db, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.Database))
+		c, err := config(cfg)
 		if err != nil {
 			return nil, err
 		}
-		return &dataSource{db: db}, nil
+		connector, err := mysql.NewConnector(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mysql config:\n%w", err)
+		}
+		return &dataSource{db: sql.OpenDB(connector)}, nil
 	})
 }
 
 type dataSource struct {
 	db *sql.DB
+	// conn holds the transaction of the snapshot, see Snapshot
+	conn *sql.Conn
+	keys db.KeyColumns
 }
 
 func (d *dataSource) DB() *sql.DB {
@@ -55,11 +64,55 @@ func (d *dataSource) DB() *sql.DB {
 }
 
 func (d *dataSource) Close() (err error) {
-	return d.db.Close()
+	if d.conn != nil {
+		err = db.EndSnapshot(d.conn)
+	}
+	if closeErr := d.db.Close(); err == nil {
+		err = closeErr
+	}
+	return
+}
+
+// query returns the connection of the snapshot if there is one.
+func (d *dataSource) query() db.Querier {
+	if d.conn != nil {
+		return d.conn
+	}
+	return d.db
+}
+
+// Snapshot starts a REPEATABLE READ transaction WITH CONSISTENT SNAPSHOT. The
+// GTID set is read right after it started, so writes that commit at the same
+// time may be in the snapshot without being in the set.
+func (d *dataSource) Snapshot(ctx context.Context) (position string, err error) {
+	if d.conn, err = db.BeginSnapshot(ctx, d.db, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ", "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY"); err != nil {
+		return
+	}
+	if err = d.conn.QueryRowContext(ctx, "SELECT NOW(6)").Scan(&position); err != nil {
+		return
+	}
+	// gtid_executed is empty or missing when the server doesn't use GTIDs
+	var gtid sql.NullString
+	if d.conn.QueryRowContext(ctx, "SELECT @@GLOBAL.gtid_executed").Scan(&gtid) == nil && gtid.String != "" {
+		position += " GTID " + gtid.String
+	}
+	return
 }
 
 func (d *dataSource) GetTableNames() (tables []string, err error) {
-	rows, err := d.db.Query("SHOW TABLES")
+	return d.GetTableNamesContext(context.Background())
+}
+
+func (d *dataSource) GetSchema(tableNames []string) (tables []schema.Table, err error) {
+	return d.GetSchemaContext(context.Background(), tableNames)
+}
+
+func (d *dataSource) TableIterator(table string, columns, orderBy []string) (iterator schema.RecordIterator, err error) {
+	return d.TableIteratorContext(context.Background(), table, columns, orderBy)
+}
+
+func (d *dataSource) GetTableNamesContext(ctx context.Context) (tables []string, err error) {
+	rows, err := d.query().QueryContext(ctx, "SHOW TABLES")
 	if err != nil {
 		return nil, err
 	}
@@ -75,78 +128,311 @@ func (d *dataSource) GetTableNames() (tables []string, err error) {
 	return
 }
 
-func (d *dataSource) GetSchema(tableNames []string) (tables []schema.Table, err error) {
+func (d *dataSource) GetSchemaContext(ctx context.Context, tableNames []string) (tables []schema.Table, err error) {
 	tables = make([]schema.Table, len(tableNames))
-	for i, table := range tables {
-		tables[i].Name = tableNames[i]
-		table = tables[i]
-		rows, err := d.db.Query(fmt.Sprintf("SHOW COLUMNS FROM `%s`", table.Name))
-		if err != nil {
+	for i, name := range tableNames {
+		tables[i].Name = name
+		if tables[i].Columns, err = d.getColumns(ctx, name); err != nil {
 			return nil, fmt.Errorf("Failed to fetch columns:\n%w", err)
 		}
-		defer rows.Close()
-		for rows.Next() {
-			var c mysqlColumn
-			err = rows.Scan(&c.Field, &c.Type, &c.Null, &c.Key, &c.Default, &c.Extra)
-			if err != nil {
-				return nil, fmt.Errorf("Failed to fetch column row:\n%w", err)
-			}
-			sCol := schema.Column{
-				Name:       c.Field,
-				Type:       c.Type,
-				Extra:      c.Extra,
-				IsNullable: c.Null == "YES",
-				IsPrimary:  c.Key == "PRI",
-			}
-			if c.Default != nil {
-				sCol.Default = *c.Default
-			}
-			tables[i].Columns = append(tables[i].Columns, sCol)
+		if tables[i].ForeignKeys, err = d.getForeignKeys(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to fetch foreign keys:\n%w", err)
+		}
+		if tables[i].Indices, err = d.getIndices(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to fetch indices:\n%w", err)
 		}
+		if tables[i].Triggers, err = d.getTriggers(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to fetch triggers:\n%w", err)
+		}
+	}
+	return
+}
 
-		// TODO: fetch foreign keys
-		fkQuery := `
-			SELECT 
-				TABLE_NAME, COLUMN_NAME, CONSTRAINT_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
-			FROM
-				INFORMATION_SCHEMA.KEY_COLUMN_USAGE
-			WHERE
-				REFERENCED_TABLE_SCHEMA = (SELECT DATABASE()) AND
-				REFERENCED_TABLE_NAME = ?
-		`
-		rows, err = d.db.Query(fkQuery, table.Name)
+func (d *dataSource) getColumns(ctx context.Context, table string) (columns []schema.Column, err error) {
+	rows, err := d.query().QueryContext(ctx, fmt.Sprintf("SHOW COLUMNS FROM `%s`", table))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c mysqlColumn
+		err = rows.Scan(&c.Field, &c.Type, &c.Null, &c.Key, &c.Default, &c.Extra)
 		if err != nil {
-			return nil, fmt.Errorf("failed to fetch foreign keys:\n%w", err)
+			return nil, fmt.Errorf("Failed to fetch column row:\n%w", err)
 		}
-		defer rows.Close()
-		for rows.Next() {
-			var fk mysqlFk
-			err = rows.Scan(&fk.TableName, &fk.ColumnName, &fk.ConstraintName, &fk.ReferencedTableName, &fk.ReferencedColumnName)
-			if err != nil {
-				return nil, fmt.Errorf("failed to fetch fk row:\n%w", err)
-			}
-			fkCol := schema.ForeignKey{
-				Name:       fk.ConstraintName,
-				From:       fk.TableName,
-				FromColumn: fk.ColumnName,
-				To:         fk.ReferencedTableName,
-				ToColumn:   fk.ReferencedColumnName,
-			}
-			tables[i].ForeignKeys = append(tables[i].ForeignKeys, fkCol)
+		sCol := schema.Column{
+			Name:            c.Field,
+			Type:            c.Type,
+			Extra:           c.Extra,
+			IsNullable:      c.Null == "YES",
+			IsPrimary:       c.Key == "PRI",
+			IsAutoIncrement: strings.Contains(c.Extra, "auto_increment"),
+		}
+		if c.Default != nil {
+			sCol.Default = *c.Default
+		}
+		columns = append(columns, sCol)
+	}
+	return columns, rows.Err()
+}
+
+// getForeignKeys returns the foreign keys declared on the table. Composite keys
+// have one entry per column which share the constraint name.
+func (d *dataSource) getForeignKeys(ctx context.Context, table string) (fks []schema.ForeignKey, err error) {
+	fkQuery := `
+		SELECT
+			TABLE_NAME, COLUMN_NAME, CONSTRAINT_NAME, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME
+		FROM
+			INFORMATION_SCHEMA.KEY_COLUMN_USAGE
+		WHERE
+			TABLE_SCHEMA = (SELECT DATABASE()) AND
+			TABLE_NAME = ? AND
+			REFERENCED_TABLE_NAME IS NOT NULL
+		ORDER BY
+			CONSTRAINT_NAME, ORDINAL_POSITION
+	`
+	rows, err := d.query().QueryContext(ctx, fkQuery, table)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fk mysqlFk
+		err = rows.Scan(&fk.TableName, &fk.ColumnName, &fk.ConstraintName, &fk.ReferencedTableName, &fk.ReferencedColumnName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch fk row:\n%w", err)
 		}
+		fks = append(fks, schema.ForeignKey{
+			Name:       fk.ConstraintName,
+			From:       fk.TableName,
+			FromColumn: fk.ColumnName,
+			To:         fk.ReferencedTableName,
+			ToColumn:   fk.ReferencedColumnName,
+		})
+	}
+	return fks, rows.Err()
+}
 
-		// TODO: fetch indicies
+func (d *dataSource) getIndices(ctx context.Context, table string) (indices []schema.Index, err error) {
+	indexQuery := `
+		SELECT
+			INDEX_NAME, INDEX_TYPE, NON_UNIQUE, COLUMN_NAME, SUB_PART
+		FROM
+			INFORMATION_SCHEMA.STATISTICS
+		WHERE
+			TABLE_SCHEMA = (SELECT DATABASE()) AND
+			TABLE_NAME = ?
+		ORDER BY
+			INDEX_NAME, SEQ_IN_INDEX
+	`
+	rows, err := d.query().QueryContext(ctx, indexQuery, table)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var idx mysqlIndex
+		err = rows.Scan(&idx.IndexName, &idx.IndexType, &idx.NonUnique, &idx.ColumnName, &idx.SubPart)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch index row:\n%w", err)
+		}
+		if len(indices) == 0 || indices[len(indices)-1].Name != idx.IndexName {
+			indices = append(indices, schema.Index{
+				Name:    idx.IndexName,
+				Type:    idx.IndexType,
+				Unique:  !idx.NonUnique,
+				Primary: idx.IndexName == "PRIMARY",
+			})
+		}
+		// functional indexes have no column name
+		if idx.ColumnName == nil {
+			continue
+		}
+		last := &indices[len(indices)-1]
+		last.Columns = append(last.Columns, *idx.ColumnName)
+		length := 0
+		if idx.SubPart != nil {
+			length = *idx.SubPart
+		}
+		last.Lengths = append(last.Lengths, length)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	for i := range indices {
+		if !hasPrefix(indices[i].Lengths) {
+			indices[i].Lengths = nil
+		}
 	}
 	return
 }
 
-func (d *dataSource) TableIterator(table string, columns, orderBy []string) (iterator schema.RecordIterator, err error) {
-	colStr := "*"
-	if len(columns) > 0 {
-		colStr = "`" + strings.Join(columns, "`,`") + "`"
+func hasPrefix(lengths []int) bool {
+	for _, l := range lengths {
+		if l > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *dataSource) getTriggers(ctx context.Context, table string) (triggers []schema.Trigger, err error) {
+	triggerQuery := `
+		SELECT
+			TRIGGER_NAME, ACTION_TIMING, EVENT_MANIPULATION, ACTION_STATEMENT
+		FROM
+			INFORMATION_SCHEMA.TRIGGERS
+		WHERE
+			EVENT_OBJECT_SCHEMA = (SELECT DATABASE()) AND
+			EVENT_OBJECT_TABLE = ?
+		ORDER BY
+			TRIGGER_NAME
+	`
+	rows, err := d.query().QueryContext(ctx, triggerQuery, table)
+	if err != nil {
+		return
 	}
+	defer rows.Close()
+	for rows.Next() {
+		var t schema.Trigger
+		if err = rows.Scan(&t.Name, &t.Timing, &t.Event, &t.SQL); err != nil {
+			return nil, fmt.Errorf("failed to fetch trigger row:\n%w", err)
+		}
+		triggers = append(triggers, t)
+	}
+	return triggers, rows.Err()
+}
+
+func (d *dataSource) TableIteratorContext(ctx context.Context, table string, columns, orderBy []string) (iterator schema.RecordIterator, err error) {
 	if len(orderBy) == 0 {
-		return d.db.Query(fmt.Sprintf("SELECT %s FROM `%s`", colStr, table))
+		return d.query().QueryContext(ctx, fmt.Sprintf("SELECT %s FROM `%s`", selectColumns(columns), table))
+	}
+	exprs, err := d.byteOrder(ctx, table, orderBy)
+	if err != nil {
+		return
+	}
+	return d.query().QueryContext(ctx, fmt.Sprintf("SELECT %s FROM `%s` ORDER BY %s", selectColumns(columns), table, strings.Join(exprs, ",")))
+}
+
+func (d *dataSource) KeyOrder(ctx context.Context, table string, key []string) (order []string, err error) {
+	columns, err := d.keyColumns(ctx, table)
+	if err != nil {
+		return
+	}
+	return db.KeyOrderOf(columns, key), nil
+}
+
+func (d *dataSource) RangeIterator(ctx context.Context, table string, columns, key []string, r db.KeyRange) (iterator schema.RecordIterator, err error) {
+	where, args := rangeWhere(quoteNames(key), r)
+	return d.query().QueryContext(ctx, fmt.Sprintf("SELECT %s FROM `%s`%s ORDER BY %s", selectColumns(columns), table, where, selectColumns(key)), args...)
+}
+
+func (d *dataSource) KeyBoundary(ctx context.Context, table string, key []string, r db.KeyRange, offset int) (boundary []string, err error) {
+	where, args := rangeWhere(quoteNames(key), r)
+	query := fmt.Sprintf("SELECT %s FROM `%s`%s ORDER BY %s LIMIT 1 OFFSET %d", selectColumns(key), table, where, selectColumns(key), offset-1)
+	return db.ScanKeyBoundary(d.query().QueryRowContext(ctx, query, args...), key)
+}
+
+// Checksum XORs the first 64 bits of the MD5 of every row. NULL is marked
+// separately because CONCAT_WS skips it.
+func (d *dataSource) Checksum(ctx context.Context, table string, columns, key []string, r db.KeyRange) (sum string, count int64, err error) {
+	values, nulls := make([]string, len(columns)), make([]string, len(columns))
+	for i, col := range columns {
+		values[i] = "`" + col + "`"
+		nulls[i] = "ISNULL(`" + col + "`)"
+	}
+	where, args := rangeWhere(quoteNames(key), r)
+	query := fmt.Sprintf(
+		"SELECT COUNT(*), BIT_XOR(CAST(CONV(LEFT(MD5(CONCAT_WS('#', %s, CONCAT(%s))), 16), 16, 10) AS UNSIGNED)) FROM `%s`%s",
+		strings.Join(values, ", "), strings.Join(nulls, ", "), table, where,
+	)
+	err = d.query().QueryRowContext(ctx, query, args...).Scan(&count, &sum)
+	return
+}
+
+func rangeWhere(exprs []string, r db.KeyRange) (where string, args []interface{}) {
+	cond, args := db.RangeCondition(exprs, r, func(int) string { return "?" })
+	if cond != "" {
+		where = " WHERE " + cond
+	}
+	return
+}
+
+func quoteNames(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = "`" + name + "`"
+	}
+	return quoted
+}
+
+func selectColumns(columns []string) string {
+	if len(columns) == 0 {
+		return "*"
+	}
+	return "`" + strings.Join(columns, "`,`") + "`"
+}
+
+// byteOrder returns the expressions that sort the key by the bytes of its text
+// columns, whatever their collation. Ranges are compared in the collation of
+// the column instead so they can use its index.
+func (d *dataSource) byteOrder(ctx context.Context, table string, key []string) (exprs []string, err error) {
+	columns, err := d.keyColumns(ctx, table)
+	if err != nil {
+		return
 	}
-	return d.db.Query(fmt.Sprintf("SELECT %s FROM `%s` ORDER BY %s", colStr, table, "`"+strings.Join(orderBy, "`,`")+"`"))
+	exprs = quoteNames(key)
+	for i, name := range key {
+		switch col := columns[name]; {
+		case col.Cast:
+			exprs[i] = "CAST(CAST(" + exprs[i] + " AS CHAR) AS BINARY)"
+		case col.Kind == schema.KindText && col.Order != db.ByteOrder:
+			exprs[i] = "CAST(" + exprs[i] + " AS BINARY)"
+		}
+	}
+	return
+}
+
+// keyColumns returns the kind and key order of the columns of the table. Binary
+// strings have no collation and the _bin collations of MySQL 8 compare bytes,
+// the other _bin collations pad with spaces.
+func (d *dataSource) keyColumns(ctx context.Context, table string) (columns map[string]db.KeyColumn, err error) {
+	return d.keys.Get(table, func() (columns map[string]db.KeyColumn, err error) {
+		columnQuery := `
+			SELECT
+				COLUMN_NAME, COLUMN_TYPE, COLLATION_NAME
+			FROM
+				INFORMATION_SCHEMA.COLUMNS
+			WHERE
+				TABLE_SCHEMA = (SELECT DATABASE()) AND
+				TABLE_NAME = ?
+		`
+		rows, err := d.query().QueryContext(ctx, columnQuery, table)
+		if err != nil {
+			return
+		}
+		defer rows.Close()
+		columns = map[string]db.KeyColumn{}
+		for rows.Next() {
+			var name, columnType string
+			var collation *string
+			if err = rows.Scan(&name, &columnType, &collation); err != nil {
+				return nil, fmt.Errorf("failed to fetch column row:\n%w", err)
+			}
+			col := db.KeyColumn{Kind: schema.KindOf(columnType)}
+			// json sorts by its values and enums and sets by their position
+			base, _, _ := strings.Cut(strings.ToLower(columnType), "(")
+			col.Cast = base == "json" || base == "enum" || base == "set"
+			if col.Kind == schema.KindText {
+				switch {
+				case collation == nil, *collation == "binary", strings.HasSuffix(*collation, "_0900_bin"):
+					col.Order = db.ByteOrder
+				default:
+					col.Order = *collation
+				}
+			}
+			columns[name] = col
+		}
+		return columns, rows.Err()
+	})
 }
@@ -0,0 +1,75 @@
+package postgres
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"sqlcmp/datasource/dsn"
+)
+
+// config maps a data source onto the connection string of lib/pq and returns
+// the schema the source reads from. The schema is empty when it's the
+// current_schema() of the connection.
+//
+// schema isn't a connection parameter, so it sets the search_path instead. The
+// other params are passed on to lib/pq, e.g. sslmode, sslrootcert and
+// connect_timeout.
+func config(cfg dsn.DataSourceConfig) (connString, schemaName string) {
+	if cfg.Host == "" {
+		cfg.Host = "localhost"
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 5432
+	}
+
+	params := url.Values{}
+	for k, v := range cfg.Params {
+		params[k] = v
+	}
+	schemaName = params.Get("schema")
+	params.Del("schema")
+	if schemaName == "" {
+		schemaName = firstSchema(params.Get("search_path"))
+	} else if params.Get("search_path") == "" {
+		params.Set("search_path", schemaName)
+	}
+
+	u := url.URL{
+		Scheme: "postgres",
+		Host:   net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Path:   "/" + cfg.Database,
+	}
+	if cfg.Protocol == "unix" {
+		// lib/pq takes the directory of the socket as the host param
+		u.Host = ""
+		params.Set("host", cfg.Host)
+		params.Set("port", strconv.Itoa(cfg.Port))
+	}
+	u.RawQuery = params.Encode()
+	if cfg.Password != "" {
+		u.User = url.UserPassword(cfg.User, cfg.Password)
+	} else if cfg.User != "" {
+		u.User = url.User(cfg.User)
+	}
+	return u.String(), schemaName
+}
+
+// firstSchema returns the first schema of a search_path. It's empty for
+// $user, the schema named after the user, which only counts when it exists, so
+// it's left to current_schema() to resolve.
+func firstSchema(searchPath string) string {
+	first, _, _ := strings.Cut(searchPath, ",")
+	first = strings.TrimSpace(first)
+	if len(first) >= 2 && first[0] == '"' && first[len(first)-1] == '"' {
+		first = strings.ReplaceAll(first[1:len(first)-1], `""`, `"`)
+	} else {
+		// unquoted names are folded to lower case
+		first = strings.ToLower(first)
+	}
+	if first == "$user" {
+		return ""
+	}
+	return first
+}
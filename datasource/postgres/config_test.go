@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"testing"
+
+	"sqlcmp/datasource/dsn"
+)
+
+func TestConfig(t *testing.T) {
+	cases := []struct {
+		dsn, connString, schema string
+	}{
+		{"postgres://app@db.example.com/shop", "postgres://app@db.example.com:5432/shop", ""},
+		{"postgres://app:p%40ss@[::1]:6432/shop?sslmode=verify-full&sslrootcert=%2Fetc%2Fca.pem", "postgres://app:p%40ss@[::1]:6432/shop?sslmode=verify-full&sslrootcert=%2Fetc%2Fca.pem", ""},
+		{"postgres://app@unix(/var/run/postgresql)/shop", "postgres://app@/shop?host=%2Fvar%2Frun%2Fpostgresql&port=5432", ""},
+		// schema sets the search_path unless it's given
+		{"postgres://localhost/shop?schema=sales", "postgres://localhost:5432/shop?search_path=sales", "sales"},
+		{"postgres://localhost/shop?schema=sales&search_path=sales,public", "postgres://localhost:5432/shop?search_path=sales%2Cpublic", "sales"},
+		{"postgres://localhost/shop?search_path=Sales,%20public", "postgres://localhost:5432/shop?search_path=Sales%2C+public", "sales"},
+		{"postgres://localhost/shop?search_path=%22Sales%22,public", "postgres://localhost:5432/shop?search_path=%22Sales%22%2Cpublic", "Sales"},
+		// $user is resolved by current_schema() since it may not exist
+		{"postgres://localhost/shop?search_path=$user,public", "postgres://localhost:5432/shop?search_path=%24user%2Cpublic", ""},
+		{"postgres://localhost/shop?search_path=%22$user%22,%20public", "postgres://localhost:5432/shop?search_path=%22%24user%22%2C+public", ""},
+	}
+	for _, c := range cases {
+		cfg, err := dsn.Parse(c.dsn)
+		if err != nil {
+			t.Fatalf("%s: %v", c.dsn, err)
+		}
+		connString, schema := config(cfg)
+		if connString != c.connString || schema != c.schema {
+			t.Errorf("%s: expected %s with schema %q, got %s with schema %q", c.dsn, c.connString, c.schema, connString, schema)
+		}
+	}
+}
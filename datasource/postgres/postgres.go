@@ -0,0 +1,484 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	db "sqlcmp/datasource"
+	"sqlcmp/datasource/dsn"
+	"sqlcmp/datasource/schema"
+
+	_ "github.com/lib/pq"
+)
+
+type pgColumn struct {
+	Name       string
+	Type       string
+	IsNullable bool
+	Default    *string
+	Identity   string
+	IsPrimary  bool
+}
+
+type pgFk struct {
+	ConstraintName       string
+	TableName            string
+	ColumnName           string
+	ReferencedTableName  string
+	ReferencedColumnName string
+}
+
+type pgIndex struct {
+	Name       string
+	Type       string
+	Unique     bool
+	Primary    bool
+	ColumnName *string
+	Constraint bool
+}
+
+func init() {
+	open := func(cfg dsn.DataSourceConfig) (source db.DataSource, err error) {
+		connString, schemaName := config(cfg)
+		db, err := sql.Open("postgres", connString)
+		if err != nil {
+			return nil, err
+		}
+		return &dataSource{db: db, schema: schemaName}, nil
+	}
+	db.RegisterSource("postgres", open)
+	db.RegisterSource("postgresql", open)
+}
+
+type dataSource struct {
+	db     *sql.DB
+	schema string
+	// conn holds the transaction of the snapshot, see Snapshot
+	conn *sql.Conn
+	keys db.KeyColumns
+}
+
+func (d *dataSource) DB() *sql.DB {
+	return d.db
+}
+
+func (d *dataSource) Close() (err error) {
+	if d.conn != nil {
+		err = db.EndSnapshot(d.conn)
+	}
+	if closeErr := d.db.Close(); err == nil {
+		err = closeErr
+	}
+	return
+}
+
+// query returns the connection of the snapshot if there is one.
+func (d *dataSource) query() db.Querier {
+	if d.conn != nil {
+		return d.conn
+	}
+	return d.db
+}
+
+// Snapshot starts a REPEATABLE READ READ ONLY transaction, its snapshot is
+// taken by the first query, which reads the position.
+func (d *dataSource) Snapshot(ctx context.Context) (position string, err error) {
+	if d.conn, err = db.BeginSnapshot(ctx, d.db, "BEGIN ISOLATION LEVEL REPEATABLE READ READ ONLY"); err != nil {
+		return
+	}
+	var timestamp, snapshot string
+	if err = d.conn.QueryRowContext(ctx, "SELECT now()::text, txid_current_snapshot()::text").Scan(&timestamp, &snapshot); err != nil {
+		return
+	}
+	return timestamp + " snapshot " + snapshot, nil
+}
+
+// schemaExpr returns the schema the source reads from, which defaults to the
+// first schema in the search_path.
+func (d *dataSource) schemaExpr() (expr string, args []interface{}) {
+	if d.schema == "" {
+		return "current_schema()", nil
+	}
+	return "$1", []interface{}{d.schema}
+}
+
+// qualify returns the quoted name of the table in the source's schema.
+func (d *dataSource) qualify(table string) string {
+	if d.schema == "" {
+		return quoteIdent(table)
+	}
+	return quoteIdent(d.schema) + "." + quoteIdent(table)
+}
+
+func (d *dataSource) GetTableNames() (tables []string, err error) {
+	return d.GetTableNamesContext(context.Background())
+}
+
+func (d *dataSource) GetSchema(tableNames []string) (tables []schema.Table, err error) {
+	return d.GetSchemaContext(context.Background(), tableNames)
+}
+
+func (d *dataSource) TableIterator(table string, columns, orderBy []string) (iterator schema.RecordIterator, err error) {
+	return d.TableIteratorContext(context.Background(), table, columns, orderBy)
+}
+
+func (d *dataSource) GetTableNamesContext(ctx context.Context) (tables []string, err error) {
+	expr, args := d.schemaExpr()
+	rows, err := d.query().QueryContext(ctx, fmt.Sprintf(`
+		SELECT table_name
+		FROM information_schema.tables
+		WHERE table_schema = %s AND table_type = 'BASE TABLE'
+		ORDER BY table_name
+	`, expr), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := ""
+		if err = rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+func (d *dataSource) GetSchemaContext(ctx context.Context, tableNames []string) (tables []schema.Table, err error) {
+	tables = make([]schema.Table, len(tableNames))
+	for i, name := range tableNames {
+		tables[i].Name = name
+		if tables[i].Columns, err = d.getColumns(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to fetch columns:\n%w", err)
+		}
+		if tables[i].ForeignKeys, err = d.getForeignKeys(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to fetch foreign keys:\n%w", err)
+		}
+		if tables[i].Indices, err = d.getIndices(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to fetch indices:\n%w", err)
+		}
+		if tables[i].Triggers, err = d.getTriggers(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to fetch triggers:\n%w", err)
+		}
+	}
+	return
+}
+
+func (d *dataSource) getColumns(ctx context.Context, table string) (columns []schema.Column, err error) {
+	q := `
+		SELECT
+			a.attname,
+			format_type(a.atttypid, a.atttypmod),
+			NOT a.attnotnull,
+			pg_get_expr(ad.adbin, ad.adrelid),
+			a.attidentity,
+			EXISTS (
+				SELECT 1 FROM pg_index i
+				WHERE i.indrelid = a.attrelid AND i.indisprimary AND a.attnum = ANY(i.indkey)
+			)
+		FROM pg_attribute a
+		LEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+		WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+		ORDER BY a.attnum
+	`
+	rows, err := d.query().QueryContext(ctx, q, d.qualify(table))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c pgColumn
+		if err = rows.Scan(&c.Name, &c.Type, &c.IsNullable, &c.Default, &c.Identity, &c.IsPrimary); err != nil {
+			return nil, err
+		}
+		sCol := schema.Column{
+			Name:       c.Name,
+			Type:       c.Type,
+			IsNullable: c.IsNullable,
+			IsPrimary:  c.IsPrimary,
+		}
+		if c.Default != nil {
+			sCol.Default = *c.Default
+		}
+		switch {
+		case c.Identity == "a":
+			sCol.IsAutoIncrement = true
+			sCol.Extra = "generated always as identity"
+		case c.Identity == "d":
+			sCol.IsAutoIncrement = true
+			sCol.Extra = "generated by default as identity"
+		case strings.HasPrefix(sCol.Default, "nextval("):
+			sCol.IsAutoIncrement = true
+		}
+		columns = append(columns, sCol)
+	}
+	return columns, rows.Err()
+}
+
+// getForeignKeys returns one entry per column of each foreign key, in
+// constraint order, so composite keys share the same name.
+func (d *dataSource) getForeignKeys(ctx context.Context, table string) (fks []schema.ForeignKey, err error) {
+	q := `
+		SELECT c.conname, cl.relname, a.attname, fcl.relname, fa.attname
+		FROM pg_constraint c
+		CROSS JOIN LATERAL unnest(c.conkey, c.confkey) WITH ORDINALITY AS k(attnum, fattnum, ord)
+		JOIN pg_class cl ON cl.oid = c.conrelid
+		JOIN pg_class fcl ON fcl.oid = c.confrelid
+		JOIN pg_attribute a ON a.attrelid = c.conrelid AND a.attnum = k.attnum
+		JOIN pg_attribute fa ON fa.attrelid = c.confrelid AND fa.attnum = k.fattnum
+		WHERE c.contype = 'f' AND c.conrelid = $1::regclass
+		ORDER BY c.conname, k.ord
+	`
+	rows, err := d.query().QueryContext(ctx, q, d.qualify(table))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var fk pgFk
+		if err = rows.Scan(&fk.ConstraintName, &fk.TableName, &fk.ColumnName, &fk.ReferencedTableName, &fk.ReferencedColumnName); err != nil {
+			return nil, err
+		}
+		fks = append(fks, schema.ForeignKey{
+			Name:       fk.ConstraintName,
+			From:       fk.TableName,
+			FromColumn: fk.ColumnName,
+			To:         fk.ReferencedTableName,
+			ToColumn:   fk.ReferencedColumnName,
+		})
+	}
+	return fks, rows.Err()
+}
+
+func (d *dataSource) getIndices(ctx context.Context, table string) (indices []schema.Index, err error) {
+	q := `
+		SELECT
+			ic.relname, upper(am.amname), i.indisunique, i.indisprimary, a.attname,
+			EXISTS (
+				SELECT 1 FROM pg_constraint c
+				WHERE c.conrelid = i.indrelid AND c.conindid = i.indexrelid AND c.contype IN ('u', 'x')
+			)
+		FROM pg_index i
+		JOIN pg_class ic ON ic.oid = i.indexrelid
+		JOIN pg_am am ON am.oid = ic.relam
+		CROSS JOIN LATERAL unnest(i.indkey) WITH ORDINALITY AS k(attnum, ord)
+		LEFT JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = k.attnum
+		WHERE i.indrelid = $1::regclass AND k.ord <= i.indnkeyatts
+		ORDER BY ic.relname, k.ord
+	`
+	rows, err := d.query().QueryContext(ctx, q, d.qualify(table))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var idx pgIndex
+		if err = rows.Scan(&idx.Name, &idx.Type, &idx.Unique, &idx.Primary, &idx.ColumnName, &idx.Constraint); err != nil {
+			return nil, err
+		}
+		if len(indices) == 0 || indices[len(indices)-1].Name != idx.Name {
+			indices = append(indices, schema.Index{Name: idx.Name, Type: idx.Type, Unique: idx.Unique, Primary: idx.Primary, Constraint: idx.Constraint})
+		}
+		// expression indexes have no column name
+		if idx.ColumnName != nil {
+			last := &indices[len(indices)-1]
+			last.Columns = append(last.Columns, *idx.ColumnName)
+		}
+	}
+	return indices, rows.Err()
+}
+
+func (d *dataSource) getTriggers(ctx context.Context, table string) (triggers []schema.Trigger, err error) {
+	q := `
+		SELECT
+			t.tgname,
+			CASE
+				WHEN t.tgtype & 2 <> 0 THEN 'BEFORE'
+				WHEN t.tgtype & 64 <> 0 THEN 'INSTEAD OF'
+				ELSE 'AFTER'
+			END,
+			concat_ws(' OR ',
+				CASE WHEN t.tgtype & 4 <> 0 THEN 'INSERT' END,
+				CASE WHEN t.tgtype & 8 <> 0 THEN 'DELETE' END,
+				CASE WHEN t.tgtype & 16 <> 0 THEN 'UPDATE' END,
+				CASE WHEN t.tgtype & 32 <> 0 THEN 'TRUNCATE' END
+			),
+			pg_get_triggerdef(t.oid)
+		FROM pg_trigger t
+		WHERE t.tgrelid = $1::regclass AND NOT t.tgisinternal
+		ORDER BY t.tgname
+	`
+	rows, err := d.query().QueryContext(ctx, q, d.qualify(table))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t schema.Trigger
+		if err = rows.Scan(&t.Name, &t.Timing, &t.Event, &t.SQL); err != nil {
+			return nil, err
+		}
+		triggers = append(triggers, t)
+	}
+	return triggers, rows.Err()
+}
+
+func (d *dataSource) TableIteratorContext(ctx context.Context, table string, columns, orderBy []string) (iterator schema.RecordIterator, err error) {
+	if len(orderBy) == 0 {
+		return d.query().QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s", selectColumns(columns), d.qualify(table)))
+	}
+	exprs, err := d.byteOrder(ctx, table, orderBy)
+	if err != nil {
+		return
+	}
+	return d.query().QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s ORDER BY %s", selectColumns(columns), d.qualify(table), strings.Join(exprs, ",")))
+}
+
+func (d *dataSource) KeyOrder(ctx context.Context, table string, key []string) (order []string, err error) {
+	columns, err := d.keyColumns(ctx, table)
+	if err != nil {
+		return
+	}
+	return db.KeyOrderOf(columns, key), nil
+}
+
+func (d *dataSource) RangeIterator(ctx context.Context, table string, columns, key []string, r db.KeyRange) (iterator schema.RecordIterator, err error) {
+	where, args := rangeWhere(quoteNames(key), r)
+	return d.query().QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s", selectColumns(columns), d.qualify(table), where, quoteIdents(key)), args...)
+}
+
+func (d *dataSource) KeyBoundary(ctx context.Context, table string, key []string, r db.KeyRange, offset int) (boundary []string, err error) {
+	where, args := rangeWhere(quoteNames(key), r)
+	query := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s LIMIT 1 OFFSET %d", quoteIdents(key), d.qualify(table), where, quoteIdents(key), offset-1)
+	return db.ScanKeyBoundary(d.query().QueryRowContext(ctx, query, args...), key)
+}
+
+// Checksum sums the first 64 bits of the MD5 of every row. NULL is marked
+// separately because concat_ws skips it.
+func (d *dataSource) Checksum(ctx context.Context, table string, columns, key []string, r db.KeyRange) (sum string, count int64, err error) {
+	values, nulls := make([]string, len(columns)), make([]string, len(columns))
+	for i, col := range columns {
+		values[i] = quoteIdent(col) + "::text"
+		nulls[i] = "(" + quoteIdent(col) + " IS NULL)::int"
+	}
+	where, args := rangeWhere(quoteNames(key), r)
+	query := fmt.Sprintf(
+		"SELECT count(*), coalesce(sum(('x' || left(md5(concat_ws('#', %s, concat(%s))), 16))::bit(64)::bigint::numeric), 0)::text FROM %s%s",
+		strings.Join(values, ", "), strings.Join(nulls, ", "), d.qualify(table), where,
+	)
+	err = d.query().QueryRowContext(ctx, query, args...).Scan(&count, &sum)
+	return
+}
+
+func rangeWhere(exprs []string, r db.KeyRange) (where string, args []interface{}) {
+	cond, args := db.RangeCondition(exprs, r, func(n int) string { return "$" + strconv.Itoa(n) })
+	if cond != "" {
+		where = " WHERE " + cond
+	}
+	return
+}
+
+func selectColumns(columns []string) string {
+	if len(columns) == 0 {
+		return "*"
+	}
+	return quoteIdents(columns)
+}
+
+// byteOrder returns the expressions that sort the key by the bytes of its text
+// columns, whatever their collation, with NULL first like the other sources.
+// Ranges are compared in the collation of the column instead so they can use
+// its index.
+func (d *dataSource) byteOrder(ctx context.Context, table string, key []string) (exprs []string, err error) {
+	columns, err := d.keyColumns(ctx, table)
+	if err != nil {
+		return
+	}
+	exprs = quoteNames(key)
+	for i, name := range key {
+		col := columns[name]
+		switch {
+		case col.Cast:
+			exprs[i] += `::text COLLATE "C"`
+		case col.Kind == schema.KindText && col.Order != db.ByteOrder:
+			exprs[i] += ` COLLATE "C"`
+		}
+		if col.Nullable {
+			exprs[i] += " NULLS FIRST"
+		}
+	}
+	return
+}
+
+// keyColumns returns the kind and key order of the columns of the table. The
+// default collation is resolved to the collation of the database. Types such as
+// uuid have no collation and sort like their text.
+func (d *dataSource) keyColumns(ctx context.Context, table string) (columns map[string]db.KeyColumn, err error) {
+	return d.keys.Get(table, func() (columns map[string]db.KeyColumn, err error) {
+		q := `
+			SELECT
+				a.attname,
+				format_type(a.atttypid, a.atttypmod),
+				NOT a.attnotnull,
+				CASE c.collname
+					WHEN 'default' THEN (SELECT datcollate::text FROM pg_database WHERE datname = current_database())
+					ELSE c.collname::text
+				END
+			FROM pg_attribute a
+			LEFT JOIN pg_collation c ON c.oid = a.attcollation
+			WHERE a.attrelid = $1::regclass AND a.attnum > 0 AND NOT a.attisdropped
+		`
+		rows, err := d.query().QueryContext(ctx, q, d.qualify(table))
+		if err != nil {
+			return
+		}
+		defer rows.Close()
+		columns = map[string]db.KeyColumn{}
+		for rows.Next() {
+			var name, columnType string
+			var nullable bool
+			var collation *string
+			if err = rows.Scan(&name, &columnType, &nullable, &collation); err != nil {
+				return nil, err
+			}
+			col := db.KeyColumn{Kind: schema.KindOf(columnType), Nullable: nullable}
+			base, _, _ := strings.Cut(columnType, "(")
+			col.Cast = col.Kind == schema.KindText && !slices.Contains(stringTypes, base)
+			if col.Kind == schema.KindText {
+				switch {
+				case collation == nil, *collation == "C", *collation == "POSIX", *collation == "ucs_basic":
+					col.Order = db.ByteOrder
+				default:
+					col.Order = *collation
+				}
+			}
+			columns[name] = col
+		}
+		return columns, rows.Err()
+	})
+}
+
+// stringTypes are the text types that sort by their collation. The others,
+// like json, arrays and enums, are cast to text to be sorted.
+var stringTypes = []string{"text", "character varying", "character", "name", "citext", "uuid"}
+
+func quoteNames(names []string) []string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	return quoted
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteIdents(names []string) string {
+	return strings.Join(quoteNames(names), ",")
+}
@@ -0,0 +1,187 @@
+package datasource
+
+import (
+	"context"
+	"database/sql"
+
+	"sqlcmp/datasource/schema"
+)
+
+// Renames maps the tables and columns of the from source to their names in the
+// to source, for tables and columns that were renamed.
+type Renames struct {
+	// Tables maps from table names to to table names
+	Tables map[string]string
+	// Columns maps the column names of a from table to to column names
+	Columns map[string]map[string]string
+}
+
+// Empty reports whether nothing is renamed.
+func (r Renames) Empty() bool {
+	return len(r.Tables) == 0 && len(r.Columns) == 0
+}
+
+// Table returns the name of a from table in the to source.
+func (r Renames) Table(table string) string {
+	if name, ok := r.Tables[table]; ok {
+		return name
+	}
+	return table
+}
+
+// Column returns the name of a column of a from table in the to source.
+func (r Renames) Column(table, column string) string {
+	if name, ok := r.Columns[table][column]; ok {
+		return name
+	}
+	return column
+}
+
+// ColumnNames returns the names of columns of a from table in the to source.
+func (r Renames) ColumnNames(table string, columns []string) []string {
+	if len(r.Columns[table]) == 0 {
+		return columns
+	}
+	renamed := make([]string, len(columns))
+	for i, col := range columns {
+		renamed[i] = r.Column(table, col)
+	}
+	return renamed
+}
+
+// Inverse returns the renames from the to source to the from source.
+func (r Renames) Inverse() Renames {
+	inverse := Renames{Tables: map[string]string{}, Columns: map[string]map[string]string{}}
+	for from, to := range r.Tables {
+		inverse.Tables[to] = from
+	}
+	for table, columns := range r.Columns {
+		renamed := map[string]string{}
+		for from, to := range columns {
+			renamed[to] = from
+		}
+		inverse.Columns[r.Table(table)] = renamed
+	}
+	return inverse
+}
+
+// Schema renames tables and the columns they hold, including those of their
+// indexes and foreign keys. Triggers are left as they are.
+func (r Renames) Schema(tables []schema.Table) []schema.Table {
+	if r.Empty() {
+		return tables
+	}
+	renamed := make([]schema.Table, len(tables))
+	for i, t := range tables {
+		name := t.Name
+		t.Name = r.Table(name)
+		t.Columns = append([]schema.Column{}, t.Columns...)
+		for j := range t.Columns {
+			t.Columns[j].Name = r.Column(name, t.Columns[j].Name)
+		}
+		t.Indices = append([]schema.Index{}, t.Indices...)
+		for j := range t.Indices {
+			t.Indices[j].Columns = r.ColumnNames(name, t.Indices[j].Columns)
+		}
+		t.ForeignKeys = append([]schema.ForeignKey{}, t.ForeignKeys...)
+		for j, fk := range t.ForeignKeys {
+			t.ForeignKeys[j].From, t.ForeignKeys[j].FromColumn = r.Table(fk.From), r.Column(fk.From, fk.FromColumn)
+			t.ForeignKeys[j].To, t.ForeignKeys[j].ToColumn = r.Table(fk.To), r.Column(fk.To, fk.ToColumn)
+		}
+		renamed[i] = t
+	}
+	return renamed
+}
+
+// Renamed returns the to source with its tables and columns under the names
+// they have in the from source, so both sources can be compared by name. The
+// returned source is a Checksummer when source is one.
+func Renamed(source DataSource, renames Renames) DataSource {
+	if renames.Empty() {
+		return source
+	}
+	r := &renamedSource{source: source, renames: renames, inverse: renames.Inverse()}
+	if checksummer, ok := source.(Checksummer); ok {
+		return &renamedChecksummer{renamedSource: r, checksummer: checksummer}
+	}
+	return r
+}
+
+type renamedSource struct {
+	source DataSource
+	// renames maps the names the source is used with to its own names and
+	// inverse maps them back
+	renames, inverse Renames
+}
+
+func (r *renamedSource) DB() *sql.DB {
+	return r.source.DB()
+}
+
+func (r *renamedSource) Close() error {
+	return r.source.Close()
+}
+
+func (r *renamedSource) GetTableNames() (tables []string, err error) {
+	return r.GetTableNamesContext(context.Background())
+}
+
+func (r *renamedSource) GetSchema(tables []string) (schema []schema.Table, err error) {
+	return r.GetSchemaContext(context.Background(), tables)
+}
+
+func (r *renamedSource) TableIterator(table string, columns, orderBy []string) (iterator schema.RecordIterator, err error) {
+	return r.TableIteratorContext(context.Background(), table, columns, orderBy)
+}
+
+func (r *renamedSource) GetTableNamesContext(ctx context.Context) (tables []string, err error) {
+	if tables, err = r.source.GetTableNamesContext(ctx); err != nil {
+		return
+	}
+	renamed := make([]string, 0, len(tables))
+	for _, table := range tables {
+		name := r.inverse.Table(table)
+		// a table that has the old name of a renamed table is hidden by it
+		if name == table && r.renames.Table(table) != table {
+			continue
+		}
+		renamed = append(renamed, name)
+	}
+	return renamed, nil
+}
+
+func (r *renamedSource) GetSchemaContext(ctx context.Context, tables []string) (schema []schema.Table, err error) {
+	names := make([]string, len(tables))
+	for i, table := range tables {
+		names[i] = r.renames.Table(table)
+	}
+	if schema, err = r.source.GetSchemaContext(ctx, names); err != nil {
+		return
+	}
+	return r.inverse.Schema(schema), nil
+}
+
+func (r *renamedSource) TableIteratorContext(ctx context.Context, table string, columns, orderBy []string) (iterator schema.RecordIterator, err error) {
+	return r.source.TableIteratorContext(ctx, r.renames.Table(table), r.renames.ColumnNames(table, columns), r.renames.ColumnNames(table, orderBy))
+}
+
+type renamedChecksummer struct {
+	*renamedSource
+	checksummer Checksummer
+}
+
+func (r *renamedChecksummer) KeyOrder(ctx context.Context, table string, key []string) (order []string, err error) {
+	return r.checksummer.KeyOrder(ctx, r.renames.Table(table), r.renames.ColumnNames(table, key))
+}
+
+func (r *renamedChecksummer) KeyBoundary(ctx context.Context, table string, key []string, kr KeyRange, offset int) (boundary []string, err error) {
+	return r.checksummer.KeyBoundary(ctx, r.renames.Table(table), r.renames.ColumnNames(table, key), kr, offset)
+}
+
+func (r *renamedChecksummer) Checksum(ctx context.Context, table string, columns, key []string, kr KeyRange) (sum string, count int64, err error) {
+	return r.checksummer.Checksum(ctx, r.renames.Table(table), r.renames.ColumnNames(table, columns), r.renames.ColumnNames(table, key), kr)
+}
+
+func (r *renamedChecksummer) RangeIterator(ctx context.Context, table string, columns, key []string, kr KeyRange) (iterator schema.RecordIterator, err error) {
+	return r.checksummer.RangeIterator(ctx, r.renames.Table(table), r.renames.ColumnNames(table, columns), r.renames.ColumnNames(table, key), kr)
+}
@@ -0,0 +1,286 @@
+package schema
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+type Status string
+
+const (
+	Added   Status = "added"
+	Removed Status = "removed"
+	Changed Status = "changed"
+)
+
+// Changes are listed from `from` to `to`, so an object that only exists in
+// `to` is Added and an object that only exists in `from` is Removed.
+type ColumnDiff struct {
+	Name    string   `json:"name"`
+	Status  Status   `json:"status"`
+	From    *Column  `json:"from,omitempty" yaml:"from,omitempty"`
+	To      *Column  `json:"to,omitempty" yaml:"to,omitempty"`
+	Changes []string `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+type IndexDiff struct {
+	Name    string   `json:"name"`
+	Status  Status   `json:"status"`
+	From    *Index   `json:"from,omitempty" yaml:"from,omitempty"`
+	To      *Index   `json:"to,omitempty" yaml:"to,omitempty"`
+	Changes []string `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+// ForeignKeyDiff holds every column of a (possibly composite) foreign key.
+type ForeignKeyDiff struct {
+	Name    string       `json:"name"`
+	Status  Status       `json:"status"`
+	From    []ForeignKey `json:"from,omitempty" yaml:"from,omitempty"`
+	To      []ForeignKey `json:"to,omitempty" yaml:"to,omitempty"`
+	Changes []string     `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+type TriggerDiff struct {
+	Name    string   `json:"name"`
+	Status  Status   `json:"status"`
+	From    *Trigger `json:"from,omitempty" yaml:"from,omitempty"`
+	To      *Trigger `json:"to,omitempty" yaml:"to,omitempty"`
+	Changes []string `json:"changes,omitempty" yaml:"changes,omitempty"`
+}
+
+type TableDiff struct {
+	Name        string           `json:"name"`
+	Status      Status           `json:"status"`
+	Columns     []ColumnDiff     `json:"columns,omitempty" yaml:"columns,omitempty"`
+	Indices     []IndexDiff      `json:"indices,omitempty" yaml:"indices,omitempty"`
+	ForeignKeys []ForeignKeyDiff `json:"foreign_keys,omitempty" yaml:"foreign_keys,omitempty"`
+	Triggers    []TriggerDiff    `json:"triggers,omitempty" yaml:"triggers,omitempty"`
+}
+
+// Diff compares two sets of tables and returns the differences sorted by
+// table name. Tables without any differences are left out.
+func Diff(from, to []Table) (diffs []TableDiff) {
+	diffs = []TableDiff{}
+	fromTables, toTables := map[string]Table{}, map[string]Table{}
+	names := []string{}
+	for _, t := range from {
+		fromTables[t.Name] = t
+		names = append(names, t.Name)
+	}
+	for _, t := range to {
+		toTables[t.Name] = t
+		if _, ok := fromTables[t.Name]; !ok {
+			names = append(names, t.Name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f, inFrom := fromTables[name]
+		t, inTo := toTables[name]
+		switch {
+		case !inTo:
+			diffs = append(diffs, TableDiff{Name: name, Status: Removed})
+		case !inFrom:
+			diffs = append(diffs, TableDiff{Name: name, Status: Added})
+		default:
+			if d := DiffTable(f, t); d.HasChanges() {
+				diffs = append(diffs, d)
+			}
+		}
+	}
+	return
+}
+
+// DiffTable compares two versions of the same table.
+func DiffTable(from, to Table) TableDiff {
+	return TableDiff{
+		Name:        from.Name,
+		Status:      Changed,
+		Columns:     diffColumns(from.Columns, to.Columns),
+		Indices:     diffIndices(from.Indices, to.Indices),
+		ForeignKeys: diffForeignKeys(from.ForeignKeys, to.ForeignKeys),
+		Triggers:    diffTriggers(from.Triggers, to.Triggers),
+	}
+}
+
+func (d TableDiff) HasChanges() bool {
+	return d.Status != Changed || len(d.Columns) > 0 || len(d.Indices) > 0 || len(d.ForeignKeys) > 0 || len(d.Triggers) > 0
+}
+
+func diffColumns(from, to []Column) (diffs []ColumnDiff) {
+	toCols := map[string]int{}
+	for i, c := range to {
+		toCols[c.Name] = i
+	}
+	seen := map[string]bool{}
+	for i := range from {
+		f := &from[i]
+		seen[f.Name] = true
+		j, ok := toCols[f.Name]
+		if !ok {
+			diffs = append(diffs, ColumnDiff{Name: f.Name, Status: Removed, From: f})
+			continue
+		}
+		t := &to[j]
+		changes := []string{}
+		if !strings.EqualFold(f.Type, t.Type) {
+			changes = append(changes, "type")
+		}
+		if f.IsNullable != t.IsNullable {
+			changes = append(changes, "nullable")
+		}
+		if f.Default != t.Default {
+			changes = append(changes, "default")
+		}
+		if f.IsPrimary != t.IsPrimary {
+			changes = append(changes, "primary")
+		}
+		if f.IsAutoIncrement != t.IsAutoIncrement || !strings.EqualFold(f.Extra, t.Extra) {
+			changes = append(changes, "extra")
+		}
+		if len(changes) > 0 {
+			diffs = append(diffs, ColumnDiff{Name: f.Name, Status: Changed, From: f, To: t, Changes: changes})
+		}
+	}
+	for i := range to {
+		if !seen[to[i].Name] {
+			diffs = append(diffs, ColumnDiff{Name: to[i].Name, Status: Added, To: &to[i]})
+		}
+	}
+	return
+}
+
+func diffIndices(from, to []Index) (diffs []IndexDiff) {
+	toIdx := map[string]int{}
+	for i, idx := range to {
+		toIdx[idx.Name] = i
+	}
+	seen := map[string]bool{}
+	for i := range from {
+		f := &from[i]
+		seen[f.Name] = true
+		j, ok := toIdx[f.Name]
+		if !ok {
+			diffs = append(diffs, IndexDiff{Name: f.Name, Status: Removed, From: f})
+			continue
+		}
+		t := &to[j]
+		changes := []string{}
+		if !strings.EqualFold(f.Type, t.Type) {
+			changes = append(changes, "type")
+		}
+		if f.Unique != t.Unique {
+			changes = append(changes, "unique")
+		}
+		if !slices.Equal(f.Columns, t.Columns) {
+			changes = append(changes, "columns")
+		}
+		if !slices.Equal(f.Lengths, t.Lengths) {
+			changes = append(changes, "lengths")
+		}
+		if len(changes) > 0 {
+			diffs = append(diffs, IndexDiff{Name: f.Name, Status: Changed, From: f, To: t, Changes: changes})
+		}
+	}
+	for i := range to {
+		if !seen[to[i].Name] {
+			diffs = append(diffs, IndexDiff{Name: to[i].Name, Status: Added, To: &to[i]})
+		}
+	}
+	return
+}
+
+// GroupForeignKeys groups the columns of each foreign key by constraint name,
+// keeping the order in which the constraints first appear.
+func GroupForeignKeys(fks []ForeignKey) (names []string, groups map[string][]ForeignKey) {
+	groups = map[string][]ForeignKey{}
+	for _, fk := range fks {
+		if _, ok := groups[fk.Name]; !ok {
+			names = append(names, fk.Name)
+		}
+		groups[fk.Name] = append(groups[fk.Name], fk)
+	}
+	return
+}
+
+func diffForeignKeys(from, to []ForeignKey) (diffs []ForeignKeyDiff) {
+	fromNames, fromGroups := GroupForeignKeys(from)
+	toNames, toGroups := GroupForeignKeys(to)
+	for _, name := range fromNames {
+		f := fromGroups[name]
+		t, ok := toGroups[name]
+		if !ok {
+			diffs = append(diffs, ForeignKeyDiff{Name: name, Status: Removed, From: f})
+			continue
+		}
+		changes := []string{}
+		if f[0].To != t[0].To {
+			changes = append(changes, "references")
+		}
+		fromCols, fromRefs := foreignKeyColumns(f)
+		toCols, toRefs := foreignKeyColumns(t)
+		if !slices.Equal(fromCols, toCols) {
+			changes = append(changes, "columns")
+		}
+		if !slices.Equal(fromRefs, toRefs) {
+			changes = append(changes, "referenced_columns")
+		}
+		if len(changes) > 0 {
+			diffs = append(diffs, ForeignKeyDiff{Name: name, Status: Changed, From: f, To: t, Changes: changes})
+		}
+	}
+	for _, name := range toNames {
+		if _, ok := fromGroups[name]; !ok {
+			diffs = append(diffs, ForeignKeyDiff{Name: name, Status: Added, To: toGroups[name]})
+		}
+	}
+	return
+}
+
+func foreignKeyColumns(fks []ForeignKey) (columns, references []string) {
+	for _, fk := range fks {
+		columns = append(columns, fk.FromColumn)
+		references = append(references, fk.ToColumn)
+	}
+	return
+}
+
+func diffTriggers(from, to []Trigger) (diffs []TriggerDiff) {
+	toTriggers := map[string]int{}
+	for i, t := range to {
+		toTriggers[t.Name] = i
+	}
+	seen := map[string]bool{}
+	for i := range from {
+		f := &from[i]
+		seen[f.Name] = true
+		j, ok := toTriggers[f.Name]
+		if !ok {
+			diffs = append(diffs, TriggerDiff{Name: f.Name, Status: Removed, From: f})
+			continue
+		}
+		t := &to[j]
+		changes := []string{}
+		if !strings.EqualFold(f.Timing, t.Timing) {
+			changes = append(changes, "timing")
+		}
+		if !strings.EqualFold(f.Event, t.Event) {
+			changes = append(changes, "event")
+		}
+		// whitespace in trigger bodies isn't significant
+		if strings.Join(strings.Fields(f.SQL), " ") != strings.Join(strings.Fields(t.SQL), " ") {
+			changes = append(changes, "sql")
+		}
+		if len(changes) > 0 {
+			diffs = append(diffs, TriggerDiff{Name: f.Name, Status: Changed, From: f, To: t, Changes: changes})
+		}
+	}
+	for i := range to {
+		if !seen[to[i].Name] {
+			diffs = append(diffs, TriggerDiff{Name: to[i].Name, Status: Added, To: &to[i]})
+		}
+	}
+	return
+}
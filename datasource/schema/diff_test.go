@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	from := []Table{
+		{Name: "gone"},
+		{
+			Name: "users",
+			Columns: []Column{
+				{Name: "id", Type: "int", IsPrimary: true},
+				{Name: "email", Type: "varchar(255)"},
+				{Name: "age", Type: "int", IsNullable: true},
+			},
+			Indices: []Index{{Name: "email_idx", Type: "BTREE", Columns: []string{"email"}}},
+			ForeignKeys: []ForeignKey{
+				{Name: "users_org", From: "users", FromColumn: "org_id", To: "orgs", ToColumn: "id"},
+				{Name: "users_org", From: "users", FromColumn: "org_region", To: "orgs", ToColumn: "region"},
+			},
+			Triggers: []Trigger{{Name: "audit", Timing: "AFTER", Event: "UPDATE", SQL: "BEGIN  SELECT 1; END"}},
+		},
+		{Name: "same", Columns: []Column{{Name: "id", Type: "int"}}},
+	}
+	to := []Table{
+		{Name: "new"},
+		{
+			Name: "users",
+			Columns: []Column{
+				{Name: "id", Type: "INT", IsPrimary: true},
+				{Name: "email", Type: "varchar(100)"},
+				{Name: "name", Type: "text"},
+			},
+			Indices: []Index{{Name: "email_idx", Type: "BTREE", Unique: true, Columns: []string{"email"}}},
+			ForeignKeys: []ForeignKey{
+				{Name: "users_org", From: "users", FromColumn: "org_id", To: "orgs", ToColumn: "id"},
+			},
+			Triggers: []Trigger{{Name: "audit", Timing: "AFTER", Event: "UPDATE", SQL: "BEGIN SELECT 1; END"}},
+		},
+		{Name: "same", Columns: []Column{{Name: "id", Type: "int"}}},
+	}
+
+	diffs := Diff(from, to)
+	if len(diffs) != 3 {
+		t.Fatalf("expected 3 table diffs, got %+v", diffs)
+	}
+	if diffs[0].Name != "gone" || diffs[0].Status != Removed {
+		t.Errorf("expected gone to be removed, got %+v", diffs[0])
+	}
+	if diffs[1].Name != "new" || diffs[1].Status != Added {
+		t.Errorf("expected new to be added, got %+v", diffs[1])
+	}
+
+	users := diffs[2]
+	if users.Name != "users" || users.Status != Changed {
+		t.Fatalf("expected users to be changed, got %+v", users)
+	}
+	if len(users.Columns) != 3 {
+		t.Fatalf("expected 3 column diffs, got %+v", users.Columns)
+	}
+	if users.Columns[0].Name != "email" || !slices.Equal(users.Columns[0].Changes, []string{"type"}) {
+		t.Errorf("expected email type to change, got %+v", users.Columns[0])
+	}
+	if users.Columns[1].Name != "age" || users.Columns[1].Status != Removed {
+		t.Errorf("expected age to be removed, got %+v", users.Columns[1])
+	}
+	if users.Columns[2].Name != "name" || users.Columns[2].Status != Added {
+		t.Errorf("expected name to be added, got %+v", users.Columns[2])
+	}
+	if len(users.Indices) != 1 || !slices.Equal(users.Indices[0].Changes, []string{"unique"}) {
+		t.Errorf("expected email_idx uniqueness to change, got %+v", users.Indices)
+	}
+	if len(users.ForeignKeys) != 1 || !slices.Equal(users.ForeignKeys[0].Changes, []string{"columns", "referenced_columns"}) {
+		t.Errorf("expected users_org columns to change, got %+v", users.ForeignKeys)
+	}
+	if len(users.Triggers) != 0 {
+		t.Errorf("expected triggers to match, got %+v", users.Triggers)
+	}
+}
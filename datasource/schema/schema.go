@@ -19,14 +19,24 @@ type Column struct {
 }
 
 type Trigger struct {
-	Name string `json:"name"`
-	SQL  string `json:"sql"`
+	Name   string `json:"name"`
+	Timing string `json:"timing"`
+	Event  string `json:"event"`
+	SQL    string `json:"sql"`
 }
 
 type Index struct {
 	Name    string   `json:"name"`
 	Type    string   `json:"type"`
+	Unique  bool     `json:"unique"`
+	Primary bool     `json:"primary"`
 	Columns []string `json:"columns"`
+	// Lengths holds the prefix length of each column, 0 meaning the whole column.
+	// It's empty when no column is indexed by a prefix.
+	Lengths []int `json:"lengths,omitempty" yaml:"lengths,omitempty"`
+	// Constraint reports whether the index belongs to a UNIQUE constraint,
+	// which has to be dropped instead of the index
+	Constraint bool `json:"constraint,omitempty" yaml:"constraint,omitempty"`
 }
 
 type ForeignKey struct {
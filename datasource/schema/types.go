@@ -0,0 +1,59 @@
+package schema
+
+import "strings"
+
+// Kind groups the column types of every driver by how their values compare.
+type Kind int
+
+const (
+	KindUnknown Kind = iota
+	KindText
+	KindInteger
+	KindDecimal
+	KindFloat
+	KindBool
+	KindDate
+	KindTime
+	KindDateTime
+	KindBinary
+)
+
+func (k Kind) IsNumeric() bool {
+	return k == KindInteger || k == KindDecimal || k == KindFloat
+}
+
+// KindOf returns the kind of a column type as reported by any of the drivers.
+// Types that aren't recognized are compared as text.
+func KindOf(sqlType string) Kind {
+	t := strings.ToLower(strings.TrimSpace(sqlType))
+	switch t {
+	case "":
+		return KindUnknown
+	case "tinyint(1)", "tinyint(1) unsigned", "bit(1)", "bool", "boolean":
+		return KindBool
+	}
+	base, _, _ := strings.Cut(t, "(")
+	base, _, _ = strings.Cut(base, " ")
+	switch base {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "int2", "int4", "int8", "serial", "smallserial", "bigserial":
+		return KindInteger
+	case "decimal", "numeric", "dec", "fixed":
+		return KindDecimal
+	case "float", "double", "real", "float4", "float8":
+		return KindFloat
+	case "date":
+		return KindDate
+	case "time", "timetz":
+		return KindTime
+	case "datetime", "timestamp", "timestamptz":
+		return KindDateTime
+	case "blob", "tinyblob", "mediumblob", "longblob", "binary", "varbinary", "bytea":
+		return KindBinary
+	}
+	return KindText
+}
+
+// Kind returns the kind of the column's type.
+func (c Column) Kind() Kind {
+	return KindOf(c.Type)
+}
@@ -0,0 +1,442 @@
+package sqlite
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strings"
+
+	db "sqlcmp/datasource"
+	"sqlcmp/datasource/dsn"
+	"sqlcmp/datasource/schema"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName is the sqlite3 driver with the functions the source needs
+const driverName = "sqlcmp_sqlite3"
+
+// triggerPattern matches the timing and event of a CREATE TRIGGER statement
+var triggerPattern = regexp.MustCompile(`(?is)^\s*CREATE\s+(?:TEMP\s+|TEMPORARY\s+)?TRIGGER\s+(?:IF\s+NOT\s+EXISTS\s+)?(?:"[^"]*"|\S+)\s+(BEFORE|AFTER|INSTEAD\s+OF)?\s*(DELETE|INSERT|UPDATE)`)
+
+type sqliteColumn struct {
+	Cid     int
+	Name    string
+	Type    string
+	NotNull bool
+	Default *string
+	Pk      int
+}
+
+type sqliteFk struct {
+	Id       int
+	Seq      int
+	Table    string
+	From     string
+	To       *string
+	OnUpdate string
+	OnDelete string
+	Match    string
+}
+
+type sqliteIndex struct {
+	Seq     int
+	Name    string
+	Unique  bool
+	Origin  string
+	Partial bool
+}
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("sqlcmp_hash", rowHash, true)
+		},
+	})
+	db.RegisterSource("sqlite3", func(cfg dsn.DataSourceConfig) (source db.DataSource, err error) {
+		if cfg.Database == "" {
+			return nil, fmt.Errorf("sqlite3 requires a database path")
+		}
+		name := cfg.Database
+		if len(cfg.Params) > 0 {
+			name = "file:" + name + "?" + cfg.Params.Encode()
+		}
+		db, err := sql.Open(driverName, name)
+		if err != nil {
+			return nil, err
+		}
+		return &dataSource{db: db}, nil
+	})
+}
+
+type dataSource struct {
+	db *sql.DB
+	// conn holds the transaction of the snapshot, see Snapshot
+	conn *sql.Conn
+	keys db.KeyColumns
+}
+
+func (d *dataSource) DB() *sql.DB {
+	return d.db
+}
+
+func (d *dataSource) Close() (err error) {
+	if d.conn != nil {
+		err = db.EndSnapshot(d.conn)
+	}
+	if closeErr := d.db.Close(); err == nil {
+		err = closeErr
+	}
+	return
+}
+
+// query returns the connection of the snapshot if there is one.
+func (d *dataSource) query() db.Querier {
+	if d.conn != nil {
+		return d.conn
+	}
+	return d.db
+}
+
+// Snapshot starts a transaction whose first read, of the position, takes the
+// snapshot. Writers wait for it to end unless the database is in WAL mode.
+func (d *dataSource) Snapshot(ctx context.Context) (position string, err error) {
+	if d.conn, err = db.BeginSnapshot(ctx, d.db, "BEGIN"); err != nil {
+		return
+	}
+	err = d.conn.QueryRowContext(ctx, "SELECT strftime('%Y-%m-%d %H:%M:%f', 'now') FROM sqlite_master LIMIT 1").Scan(&position)
+	return
+}
+
+func (d *dataSource) GetTableNames() (tables []string, err error) {
+	return d.GetTableNamesContext(context.Background())
+}
+
+func (d *dataSource) GetSchema(tableNames []string) (tables []schema.Table, err error) {
+	return d.GetSchemaContext(context.Background(), tableNames)
+}
+
+func (d *dataSource) TableIterator(table string, columns, orderBy []string) (iterator schema.RecordIterator, err error) {
+	return d.TableIteratorContext(context.Background(), table, columns, orderBy)
+}
+
+func (d *dataSource) GetTableNamesContext(ctx context.Context) (tables []string, err error) {
+	rows, err := d.query().QueryContext(ctx, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite\\_%' ESCAPE '\\' ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := ""
+		if err = rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, rows.Err()
+}
+
+func (d *dataSource) GetSchemaContext(ctx context.Context, tableNames []string) (tables []schema.Table, err error) {
+	tables = make([]schema.Table, len(tableNames))
+	for i, name := range tableNames {
+		tables[i].Name = name
+		if tables[i].Columns, err = d.getColumns(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to fetch columns:\n%w", err)
+		}
+		if tables[i].ForeignKeys, err = d.getForeignKeys(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to fetch foreign keys:\n%w", err)
+		}
+		if tables[i].Indices, err = d.getIndices(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to fetch indices:\n%w", err)
+		}
+		if tables[i].Triggers, err = d.getTriggers(ctx, name); err != nil {
+			return nil, fmt.Errorf("failed to fetch triggers:\n%w", err)
+		}
+	}
+	return
+}
+
+func (d *dataSource) getColumns(ctx context.Context, table string) (columns []schema.Column, err error) {
+	var createSQL string
+	if err = d.query().QueryRowContext(ctx, "SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&createSQL); err != nil {
+		return
+	}
+	rows, err := d.query().QueryContext(ctx, "SELECT cid, name, type, \"notnull\", dflt_value, pk FROM pragma_table_info(?)", table)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c sqliteColumn
+		if err = rows.Scan(&c.Cid, &c.Name, &c.Type, &c.NotNull, &c.Default, &c.Pk); err != nil {
+			return nil, err
+		}
+		sCol := schema.Column{
+			Name:       c.Name,
+			Type:       c.Type,
+			IsNullable: !c.NotNull && c.Pk == 0,
+			IsPrimary:  c.Pk > 0,
+		}
+		if c.Default != nil {
+			sCol.Default = *c.Default
+		}
+		// only an INTEGER PRIMARY KEY can be declared with AUTOINCREMENT
+		if c.Pk > 0 && strings.EqualFold(c.Type, "INTEGER") && strings.Contains(strings.ToUpper(createSQL), "AUTOINCREMENT") {
+			sCol.IsAutoIncrement = true
+			sCol.Extra = "autoincrement"
+		}
+		columns = append(columns, sCol)
+	}
+	return columns, rows.Err()
+}
+
+func (d *dataSource) getForeignKeys(ctx context.Context, table string) (fks []schema.ForeignKey, err error) {
+	rows, err := d.query().QueryContext(ctx, "SELECT id, seq, \"table\", \"from\", \"to\", on_update, on_delete, \"match\" FROM pragma_foreign_key_list(?) ORDER BY id, seq", table)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	var missingTo []int
+	for rows.Next() {
+		var fk sqliteFk
+		if err = rows.Scan(&fk.Id, &fk.Seq, &fk.Table, &fk.From, &fk.To, &fk.OnUpdate, &fk.OnDelete, &fk.Match); err != nil {
+			return nil, err
+		}
+		// sqlite doesn't name foreign key constraints so we name them by table and position
+		sFk := schema.ForeignKey{
+			Name:       fmt.Sprintf("%s_fk_%d", table, fk.Id),
+			From:       table,
+			FromColumn: fk.From,
+			To:         fk.Table,
+		}
+		if fk.To != nil {
+			sFk.ToColumn = *fk.To
+		} else {
+			missingTo = append(missingTo, len(fks))
+		}
+		fks = append(fks, sFk)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	rows.Close()
+
+	// a foreign key without target columns references the primary key of the parent table
+	for _, i := range missingTo {
+		pk, err := d.getPrimaryKey(ctx, fks[i].To)
+		if err != nil {
+			return nil, err
+		}
+		seq := 0
+		for j := i - 1; j >= 0 && fks[j].Name == fks[i].Name; j-- {
+			seq++
+		}
+		if seq < len(pk) {
+			fks[i].ToColumn = pk[seq]
+		}
+	}
+	return
+}
+
+func (d *dataSource) getPrimaryKey(ctx context.Context, table string) (pk []string, err error) {
+	rows, err := d.query().QueryContext(ctx, "SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk", table)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		pk = append(pk, name)
+	}
+	return pk, rows.Err()
+}
+
+func (d *dataSource) getIndices(ctx context.Context, table string) (indices []schema.Index, err error) {
+	rows, err := d.query().QueryContext(ctx, "SELECT seq, name, \"unique\", origin, partial FROM pragma_index_list(?) ORDER BY name", table)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var idx sqliteIndex
+		if err = rows.Scan(&idx.Seq, &idx.Name, &idx.Unique, &idx.Origin, &idx.Partial); err != nil {
+			return nil, err
+		}
+		indices = append(indices, schema.Index{
+			Name:    idx.Name,
+			Type:    "BTREE",
+			Unique:  idx.Unique,
+			Primary: idx.Origin == "pk",
+		})
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	rows.Close()
+
+	for i := range indices {
+		cols, err := d.query().QueryContext(ctx, "SELECT name FROM pragma_index_info(?) ORDER BY seqno", indices[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		for cols.Next() {
+			var name *string
+			if err = cols.Scan(&name); err != nil {
+				cols.Close()
+				return nil, err
+			}
+			// expression indexes have no column name
+			if name != nil {
+				indices[i].Columns = append(indices[i].Columns, *name)
+			}
+		}
+		err = cols.Err()
+		cols.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+func (d *dataSource) getTriggers(ctx context.Context, table string) (triggers []schema.Trigger, err error) {
+	rows, err := d.query().QueryContext(ctx, "SELECT name, sql FROM sqlite_master WHERE type = 'trigger' AND tbl_name = ? ORDER BY name", table)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t schema.Trigger
+		if err = rows.Scan(&t.Name, &t.SQL); err != nil {
+			return nil, err
+		}
+		if m := triggerPattern.FindStringSubmatch(t.SQL); m != nil {
+			t.Timing = strings.ToUpper(strings.Join(strings.Fields(m[1]), " "))
+			if t.Timing == "" {
+				t.Timing = "BEFORE"
+			}
+			t.Event = strings.ToUpper(m[2])
+		}
+		triggers = append(triggers, t)
+	}
+	return triggers, rows.Err()
+}
+
+func (d *dataSource) TableIteratorContext(ctx context.Context, table string, columns, orderBy []string) (iterator schema.RecordIterator, err error) {
+	if len(orderBy) > 0 {
+		return d.RangeIterator(ctx, table, columns, orderBy, db.KeyRange{})
+	}
+	return d.query().QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s", selectColumns(columns), quoteIdent(table)))
+}
+
+func (d *dataSource) RangeIterator(ctx context.Context, table string, columns, key []string, r db.KeyRange) (iterator schema.RecordIterator, err error) {
+	exprs := keyExprs(key)
+	where, args := rangeWhere(exprs, r)
+	return d.query().QueryContext(ctx, fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s", selectColumns(columns), quoteIdent(table), where, strings.Join(exprs, ",")), args...)
+}
+
+func (d *dataSource) KeyBoundary(ctx context.Context, table string, key []string, r db.KeyRange, offset int) (boundary []string, err error) {
+	exprs := keyExprs(key)
+	where, args := rangeWhere(exprs, r)
+	query := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s LIMIT 1 OFFSET %d", quoteIdents(key), quoteIdent(table), where, strings.Join(exprs, ","), offset-1)
+	return db.ScanKeyBoundary(d.query().QueryRowContext(ctx, query, args...), key)
+}
+
+// KeyOrder orders text by its bytes, see keyExprs.
+func (d *dataSource) KeyOrder(ctx context.Context, table string, key []string) (order []string, err error) {
+	columns, err := d.keys.Get(table, func() (columns map[string]db.KeyColumn, err error) {
+		cols, err := d.getColumns(ctx, table)
+		if err != nil {
+			return
+		}
+		columns = map[string]db.KeyColumn{}
+		for _, c := range cols {
+			col := db.KeyColumn{Kind: c.Kind()}
+			if col.Kind == schema.KindText {
+				col.Order = db.ByteOrder
+			}
+			columns[c.Name] = col
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	return db.KeyOrderOf(columns, key), nil
+}
+
+// Checksum sums the hash of every row, which is computed by rowHash since
+// SQLite doesn't have a hash function of its own.
+func (d *dataSource) Checksum(ctx context.Context, table string, columns, key []string, r db.KeyRange) (sum string, count int64, err error) {
+	where, args := rangeWhere(keyExprs(key), r)
+	query := fmt.Sprintf("SELECT count(*), coalesce(sum(sqlcmp_hash(%s)), 0) FROM %s%s", quoteIdents(columns), quoteIdent(table), where)
+	err = d.query().QueryRowContext(ctx, query, args...).Scan(&count, &sum)
+	return
+}
+
+// rowHash returns the first 31 bits of the MD5 of the values so the sum of
+// billions of rows doesn't overflow. NULL is hashed as a marker byte and other
+// values as another one followed by their length, so no two rows of different
+// values hash the same bytes.
+func rowHash(values ...interface{}) int64 {
+	h := md5.New()
+	for _, v := range values {
+		var b []byte
+		switch v := v.(type) {
+		case nil:
+			h.Write([]byte{0})
+			continue
+		case []byte:
+			b = v
+		default:
+			b = []byte(fmt.Sprint(v))
+		}
+		h.Write([]byte{1})
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(len(b))))
+		h.Write(b)
+	}
+	return int64(binary.BigEndian.Uint32(h.Sum(nil)) >> 1)
+}
+
+func rangeWhere(exprs []string, r db.KeyRange) (where string, args []interface{}) {
+	cond, args := db.RangeCondition(exprs, r, func(int) string { return "?" })
+	if cond != "" {
+		where = " WHERE " + cond
+	}
+	return
+}
+
+func selectColumns(columns []string) string {
+	if len(columns) == 0 {
+		return "*"
+	}
+	return quoteIdents(columns)
+}
+
+// keyExprs sorts by bytes even if a column is declared with another collation.
+func keyExprs(key []string) []string {
+	exprs := make([]string, len(key))
+	for i, name := range key {
+		exprs[i] = quoteIdent(name) + " COLLATE BINARY"
+	}
+	return exprs
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteIdents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdent(name)
+	}
+	return strings.Join(quoted, ",")
+}
@@ -0,0 +1,301 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sqlcmp/compare"
+	db "sqlcmp/datasource"
+	"sqlcmp/datasource/dsn"
+)
+
+const fixture = `
+CREATE TABLE parent (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	code TEXT NOT NULL UNIQUE
+);
+CREATE TABLE child (
+	a INTEGER NOT NULL,
+	b INTEGER NOT NULL,
+	parent_id INTEGER REFERENCES parent,
+	note TEXT DEFAULT 'none',
+	PRIMARY KEY (a, b)
+);
+CREATE INDEX child_note ON child (note, parent_id);
+CREATE TRIGGER child_note_trigger AFTER INSERT ON child BEGIN UPDATE child SET note = 'new' WHERE a = NEW.a; END;
+INSERT INTO child (a, b, note) VALUES (2, 1, 'x'), (1, 2, 'y');
+`
+
+func openFixture(t *testing.T) db.DataSource {
+	return openSQL(t, "test.db", fixture)
+}
+
+func openSQL(t *testing.T, name, sql string) db.DataSource {
+	cfg, err := dsn.Parse("sqlite3://" + filepath.Join(t.TempDir(), name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := db.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { source.Close() })
+	if _, err = source.DB().Exec(sql); err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func TestGetSchema(t *testing.T) {
+	source := openFixture(t)
+	names, err := source.GetTableNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "child" || names[1] != "parent" {
+		t.Fatalf("expected tables [child parent], got %v", names)
+	}
+	tables, err := source.GetSchema(names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, parent := tables[0], tables[1]
+
+	if len(child.Columns) != 4 || !child.Columns[0].IsPrimary || !child.Columns[1].IsPrimary || child.Columns[3].Default != "'none'" {
+		t.Errorf("unexpected child columns %+v", child.Columns)
+	}
+	if !parent.Columns[0].IsAutoIncrement {
+		t.Errorf("expected parent.id to be auto increment")
+	}
+	if len(child.ForeignKeys) != 1 || child.ForeignKeys[0].ToColumn != "id" || child.ForeignKeys[0].To != "parent" {
+		t.Errorf("unexpected child foreign keys %+v", child.ForeignKeys)
+	}
+	if len(child.Triggers) != 1 || child.Triggers[0].Name != "child_note_trigger" || child.Triggers[0].Timing != "AFTER" || child.Triggers[0].Event != "INSERT" {
+		t.Errorf("unexpected child triggers %+v", child.Triggers)
+	}
+	found := false
+	for _, idx := range child.Indices {
+		if idx.Name == "child_note" {
+			found = true
+			if idx.Unique || len(idx.Columns) != 2 || idx.Columns[0] != "note" {
+				t.Errorf("unexpected index %+v", idx)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("missing index child_note in %+v", child.Indices)
+	}
+	if len(parent.Indices) != 1 || !parent.Indices[0].Unique || parent.Indices[0].Columns[0] != "code" {
+		t.Errorf("unexpected parent indices %+v", parent.Indices)
+	}
+}
+
+func TestTableIterator(t *testing.T) {
+	source := openFixture(t)
+	rows, err := source.TableIterator("child", []string{"a", "b"}, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var keys [][2]int
+	for rows.Next() {
+		var k [2]int
+		if err = rows.Scan(&k[0], &k[1]); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) != 2 || keys[0] != [2]int{1, 2} || keys[1] != [2]int{2, 1} {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	rows := []string{}
+	for a := 0; a < 50; a++ {
+		for b := 0; b < 20; b++ {
+			rows = append(rows, fmt.Sprintf("(%d, 'k%d', 'v%d')", a, b, a*b))
+		}
+	}
+	create := "CREATE TABLE t (a INTEGER, b TEXT COLLATE NOCASE, v TEXT, PRIMARY KEY (a, b));\nINSERT INTO t VALUES " + strings.Join(rows, ", ") + ";\n"
+	from := openSQL(t, "from.db", create)
+	to := openSQL(t, "to.db", create+`
+		DELETE FROM t WHERE a = 3 AND b = 'k7';
+		UPDATE t SET v = NULL WHERE a = 20 AND b = 'k1';
+		UPDATE t SET v = 'changed' WHERE a = 49 AND b = 'k19';
+		INSERT INTO t VALUES (60, 'K', 'x'), (-1, 'a', 'y');
+	`)
+	table := compare.Table{Name: "t", Columns: []string{"a", "b", "v"}, Key: []int{0, 1}}
+	var expected, diffs []compare.Difference
+	fromIter, err := from.TableIterator("t", table.Columns, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	toIter, err := to.TableIterator("t", table.Columns, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedCounts, err := compare.Rows(fromIter, toIter, table, func(d compare.Difference) error {
+		expected = append(expected, d)
+		return nil
+	})
+	fromIter.Close()
+	toIter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := compare.ChecksumOptions{ChunkSize: 100, RowThreshold: 3}
+	counts, err := compare.Checksum(context.Background(), from.(db.Checksummer), to.(db.Checksummer), table, opts, func(d compare.Difference) error {
+		diffs = append(diffs, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts != expectedCounts || counts.Differences() != 5 {
+		t.Errorf("expected counts %+v, got %+v", expectedCounts, counts)
+	}
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("expected differences %v, got %v", expected, diffs)
+	}
+}
+
+func TestKeyBoundary(t *testing.T) {
+	source := openSQL(t, "test.db", `
+		CREATE TABLE t (a INTEGER, b TEXT);
+		INSERT INTO t VALUES (1, 'x'), (2, 'y'), (3, NULL);
+	`).(db.Checksummer)
+	ctx := context.Background()
+	order, err := source.KeyOrder(ctx, "t", []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(order, []string{"", db.ByteOrder}) {
+		t.Errorf("unexpected key order %q", order)
+	}
+	// the offset counts from the previous boundary
+	boundary, err := source.KeyBoundary(ctx, "t", []string{"a", "b"}, db.KeyRange{After: []string{"1", "x"}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(boundary, []string{"2", "y"}) {
+		t.Errorf("expected boundary [2 y], got %v", boundary)
+	}
+	if boundary, err = source.KeyBoundary(ctx, "t", []string{"a", "b"}, db.KeyRange{After: []string{"2", "y"}}, 2); boundary != nil || err != nil {
+		t.Errorf("expected no boundary past the last row, got %v, %v", boundary, err)
+	}
+	if _, err = source.KeyBoundary(ctx, "t", []string{"a", "b"}, db.KeyRange{After: []string{"2", "y"}}, 1); !errors.Is(err, db.ErrNullKey) {
+		t.Errorf("expected a NULL key error, got %v", err)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	// in WAL mode writers don't wait for the snapshot to end
+	source := openSQL(t, "test.db", "PRAGMA journal_mode=WAL;"+fixture)
+	ctx := context.Background()
+	position, err := source.(db.Snapshotter).Snapshot(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if position == "" {
+		t.Error("expected the position of the snapshot")
+	}
+	if _, err = source.DB().Exec("INSERT INTO child (a, b) VALUES (3, 3)"); err != nil {
+		t.Fatal(err)
+	}
+	iterator, err := source.TableIteratorContext(ctx, "child", []string{"a", "b"}, []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iterator.Close()
+	rows := 0
+	for iterator.Next() {
+		rows++
+	}
+	if err = iterator.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 2 {
+		t.Errorf("expected the 2 rows of the snapshot, got %d", rows)
+	}
+}
+
+func TestRenamed(t *testing.T) {
+	renames := db.Renames{Tables: map[string]string{"kid": "child"}, Columns: map[string]map[string]string{"kid": {"remark": "note"}}}
+	source := db.Renamed(openSQL(t, "test.db", fixture+"CREATE TABLE kid (x INTEGER);"), renames)
+	names, err := source.GetTableNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the old kid table is hidden by the renamed child table
+	if !reflect.DeepEqual(names, []string{"kid", "parent"}) {
+		t.Fatalf("expected tables [kid parent], got %v", names)
+	}
+	tables, err := source.GetSchema([]string{"kid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := tables[0]
+	if kid.Name != "kid" || kid.Columns[3].Name != "remark" || len(kid.ForeignKeys) != 1 || kid.ForeignKeys[0].From != "kid" {
+		t.Errorf("expected the schema under the from names, got %+v", kid)
+	}
+	for _, idx := range kid.Indices {
+		if idx.Name == "child_note" && idx.Columns[0] != "remark" {
+			t.Errorf("expected the index columns under the from names, got %+v", idx)
+		}
+	}
+	if back := renames.Schema(tables); back[0].Name != "child" || back[0].Columns[3].Name != "note" {
+		t.Errorf("expected the schema under the to names, got %+v", back[0])
+	}
+	if _, ok := source.(db.Checksummer); !ok {
+		t.Error("expected the renamed source to be a Checksummer")
+	}
+	rows, err := source.TableIterator("kid", []string{"a", "remark"}, []string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var notes []string
+	for rows.Next() {
+		var a int
+		var note string
+		if err = rows.Scan(&a, &note); err != nil {
+			t.Fatal(err)
+		}
+		notes = append(notes, fmt.Sprintf("%d:%s", a, note))
+	}
+	// the trigger of the fixture overwrote the notes
+	if !reflect.DeepEqual(notes, []string{"1:new", "2:new"}) {
+		t.Errorf("expected the rows [1:new 2:new], got %v", notes)
+	}
+}
+
+func TestGetTableNames(t *testing.T) {
+	// only the underscore after sqlite marks an internal table
+	source := openSQL(t, "test.db", "CREATE TABLE sqlitedata (id INTEGER PRIMARY KEY AUTOINCREMENT); CREATE TABLE t (id INTEGER)")
+	tables, err := source.GetTableNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"sqlitedata", "t"}; !reflect.DeepEqual(tables, expected) {
+		t.Errorf("expected tables %v, got %v", expected, tables)
+	}
+}
+
+func TestRowHash(t *testing.T) {
+	pairs := [][2][]interface{}{
+		{{nil}, {[]byte{0}}},
+		{{[]byte("a\x01"), []byte("")}, {[]byte("a"), []byte("\x01")}},
+		{{nil, []byte("")}, {[]byte(""), nil}},
+	}
+	for _, p := range pairs {
+		if rowHash(p[0]...) == rowHash(p[1]...) {
+			t.Errorf("rows %q and %q hash the same", p[0], p[1])
+		}
+	}
+}
@@ -4,6 +4,8 @@ go 1.21.6
 
 require (
 	github.com/go-sql-driver/mysql v1.8.1
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/urfave/cli/v2 v2.27.1
 	github.com/wyattis/z v0.12.5
 	golang.org/x/term v0.18.0
@@ -2,12 +2,14 @@ package main
 
 import (
 	_ "embed"
-	"log"
+	"fmt"
 	"os"
 
 	"sqlcmp/cli"
 	_ "sqlcmp/datasource"
 	_ "sqlcmp/datasource/mysql"
+	_ "sqlcmp/datasource/postgres"
+	_ "sqlcmp/datasource/sqlite"
 )
 
 //go:embed VERSION
@@ -15,7 +17,9 @@ var VERSION string
 
 func main() {
 	cli.VERSION = VERSION
+	// findings exit with cli.ExitFindings from Run, anything else is an error
 	if err := cli.App.Run(os.Args); err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(cli.ExitError)
 	}
 }
@@ -0,0 +1,119 @@
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"sqlcmp/datasource/dialect"
+	"sqlcmp/datasource/schema"
+)
+
+// Statements returns the DDL that makes the `to` tables match the `from`
+// tables. Statements are ordered so that foreign keys are dropped before the
+// columns and tables they depend on, and tables and indexes are created before
+// the foreign keys that reference them.
+func Statements(d dialect.Dialect, from, to []schema.Table) (stmts []string) {
+	fromTables, toTables := byName(from), byName(to)
+	var (
+		dropFks, dropTriggers, dropIndices, dropColumns, dropTables  []string
+		createTables, addColumns, createIndices, addFks, addTriggers []string
+	)
+	for _, t := range schema.Diff(from, to) {
+		switch t.Status {
+		case schema.Added:
+			table := toTables[t.Name]
+			if !d.InlineForeignKeys() {
+				names, _ := schema.GroupForeignKeys(table.ForeignKeys)
+				for _, name := range names {
+					dropFks = append(dropFks, d.DropForeignKey(t.Name, name))
+				}
+			}
+			dropTables = append(dropTables, d.DropTable(t.Name))
+		case schema.Removed:
+			table := fromTables[t.Name]
+			createTables = append(createTables, d.CreateTable(table))
+			for _, idx := range table.Indices {
+				if !idx.Primary {
+					createIndices = append(createIndices, d.CreateIndex(t.Name, idx))
+				}
+			}
+			if !d.InlineForeignKeys() {
+				names, groups := schema.GroupForeignKeys(table.ForeignKeys)
+				for _, name := range names {
+					addFks = append(addFks, d.AddForeignKey(t.Name, groups[name]))
+				}
+			}
+			for _, tr := range table.Triggers {
+				addTriggers = append(addTriggers, d.CreateTrigger(t.Name, tr))
+			}
+		case schema.Changed:
+			for _, c := range t.Columns {
+				switch c.Status {
+				case schema.Added:
+					dropColumns = append(dropColumns, d.DropColumn(t.Name, c.Name))
+				case schema.Removed:
+					addColumns = append(addColumns, d.AddColumn(t.Name, *c.From))
+				case schema.Changed:
+					// primary key changes are made through the primary index
+					if len(c.Changes) > 1 || c.Changes[0] != "primary" {
+						addColumns = append(addColumns, d.ModifyColumn(t.Name, *c.To, *c.From)...)
+					}
+				}
+			}
+			for _, idx := range t.Indices {
+				if idx.To != nil {
+					dropIndices = append(dropIndices, d.DropIndex(t.Name, *idx.To))
+				}
+				if idx.From != nil {
+					createIndices = append(createIndices, d.CreateIndex(t.Name, *idx.From))
+				}
+			}
+			for _, fk := range t.ForeignKeys {
+				if fk.To != nil {
+					dropFks = append(dropFks, d.DropForeignKey(t.Name, fk.Name))
+				}
+				if fk.From != nil {
+					addFks = append(addFks, d.AddForeignKey(t.Name, fk.From))
+				}
+			}
+			for _, tr := range t.Triggers {
+				if tr.To != nil {
+					dropTriggers = append(dropTriggers, d.DropTrigger(t.Name, *tr.To))
+				}
+				if tr.From != nil {
+					addTriggers = append(addTriggers, d.CreateTrigger(t.Name, *tr.From))
+				}
+			}
+		}
+	}
+	for _, group := range [][]string{
+		dropFks, dropTriggers, dropIndices, dropColumns, dropTables,
+		createTables, addColumns, createIndices, addFks, addTriggers,
+	} {
+		stmts = append(stmts, group...)
+	}
+	return
+}
+
+// Write writes the statements as a SQL script for the client of the dialect's
+// database.
+func Write(w io.Writer, d dialect.Dialect, stmts []string) (err error) {
+	for _, stmt := range stmts {
+		if !strings.HasPrefix(stmt, "--") {
+			stmt = d.EndStatement(stmt)
+		}
+		if _, err = fmt.Fprintln(w, stmt); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func byName(tables []schema.Table) map[string]schema.Table {
+	res := make(map[string]schema.Table, len(tables))
+	for _, t := range tables {
+		res[t.Name] = t
+	}
+	return res
+}
@@ -0,0 +1,194 @@
+package migrate
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"sqlcmp/datasource/dialect"
+	"sqlcmp/datasource/schema"
+)
+
+func TestStatements(t *testing.T) {
+	from := []schema.Table{
+		{
+			Name: "orgs",
+			Columns: []schema.Column{
+				{Name: "id", Type: "int", IsPrimary: true, IsAutoIncrement: true, Extra: "auto_increment"},
+				{Name: "name", Type: "varchar(20)", Default: "none"},
+			},
+			Indices: []schema.Index{
+				{Name: "PRIMARY", Type: "BTREE", Unique: true, Primary: true, Columns: []string{"id"}},
+				{Name: "name_idx", Type: "BTREE", Columns: []string{"name"}, Lengths: []int{10}},
+			},
+		},
+		{
+			Name: "users",
+			Columns: []schema.Column{
+				{Name: "id", Type: "int", IsPrimary: true},
+				{Name: "org_id", Type: "int", IsNullable: true},
+			},
+			ForeignKeys: []schema.ForeignKey{
+				{Name: "users_org", From: "users", FromColumn: "org_id", To: "orgs", ToColumn: "id"},
+			},
+		},
+	}
+	to := []schema.Table{
+		{
+			Name: "users",
+			Columns: []schema.Column{
+				{Name: "id", Type: "bigint", IsPrimary: true},
+				{Name: "legacy_id", Type: "int"},
+			},
+			ForeignKeys: []schema.ForeignKey{
+				{Name: "users_legacy", From: "users", FromColumn: "legacy_id", To: "legacy", ToColumn: "id"},
+			},
+		},
+		{
+			Name: "legacy",
+			Columns: []schema.Column{
+				{Name: "id", Type: "int", IsPrimary: true},
+			},
+		},
+	}
+
+	d, err := dialect.Get("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"ALTER TABLE `users` DROP FOREIGN KEY `users_legacy`",
+		"ALTER TABLE `users` DROP COLUMN `legacy_id`",
+		"DROP TABLE `legacy`",
+		"CREATE TABLE `orgs` (\n  `id` int NOT NULL auto_increment,\n  `name` varchar(20) NOT NULL DEFAULT 'none',\n  PRIMARY KEY (`id`)\n)",
+		"ALTER TABLE `users` MODIFY COLUMN `id` int NOT NULL",
+		"ALTER TABLE `users` ADD COLUMN `org_id` int",
+		"CREATE INDEX `name_idx` ON `orgs` (`name`(10))",
+		"ALTER TABLE `users` ADD CONSTRAINT `users_org` FOREIGN KEY (`org_id`) REFERENCES `orgs` (`id`)",
+	}
+	stmts := Statements(d, from, to)
+	if !slices.Equal(stmts, expected) {
+		t.Errorf("unexpected statements:\n%q\nexpected:\n%q", stmts, expected)
+	}
+}
+
+func TestPostgresConstraintIndex(t *testing.T) {
+	columns := []schema.Column{{Name: "id", Type: "integer", IsPrimary: true}, {Name: "email", Type: "text"}}
+	from := []schema.Table{{Name: "users", Columns: columns, Indices: []schema.Index{
+		{Name: "users_email_key", Type: "BTREE", Unique: true, Constraint: true, Columns: []string{"id", "email"}},
+	}}}
+	to := []schema.Table{{Name: "users", Columns: columns, Indices: []schema.Index{
+		{Name: "users_email_key", Type: "BTREE", Unique: true, Constraint: true, Columns: []string{"email"}},
+	}}}
+	d, err := dialect.Get("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`ALTER TABLE "users" DROP CONSTRAINT "users_email_key"`,
+		`ALTER TABLE "users" ADD CONSTRAINT "users_email_key" UNIQUE ("id", "email")`,
+	}
+	if stmts := Statements(d, from, to); !slices.Equal(stmts, expected) {
+		t.Errorf("unexpected statements:\n%q\nexpected:\n%q", stmts, expected)
+	}
+}
+
+func TestConvertedStatements(t *testing.T) {
+	mysqlTables := []schema.Table{{
+		Name: "orgs",
+		Columns: []schema.Column{
+			{Name: "id", Type: "int(11)", IsPrimary: true, IsAutoIncrement: true, Extra: "auto_increment"},
+			{Name: "name", Type: "varchar(255)", Default: "none"},
+			{Name: "active", Type: "tinyint(1)", Default: "1"},
+			{Name: "created", Type: "timestamp", IsNullable: true, Default: "CURRENT_TIMESTAMP", Extra: "DEFAULT_GENERATED"},
+		},
+		Indices: []schema.Index{
+			{Name: "PRIMARY", Type: "BTREE", Unique: true, Primary: true, Columns: []string{"id"}},
+			{Name: "name_idx", Type: "BTREE", Columns: []string{"name"}, Lengths: []int{10}},
+		},
+	}}
+	postgresTables := []schema.Table{{
+		Name: "orgs",
+		Columns: []schema.Column{
+			{Name: "id", Type: "integer", IsPrimary: true, IsAutoIncrement: true, Default: "nextval('orgs_id_seq'::regclass)"},
+			{Name: "name", Type: "character varying(255)", Default: "'none'::character varying"},
+			{Name: "active", Type: "boolean", Default: "true"},
+			{Name: "created", Type: "timestamp with time zone", IsNullable: true, Default: "now()"},
+		},
+		Indices: []schema.Index{
+			{Name: "orgs_pkey", Type: "BTREE", Unique: true, Primary: true, Columns: []string{"id"}},
+			{Name: "name_idx", Type: "BTREE", Columns: []string{"name"}},
+		},
+	}}
+	cases := []struct {
+		from, to string
+		tables   []schema.Table
+		expected []string
+	}{
+		{"mysql", "postgres", mysqlTables, []string{
+			"CREATE TABLE \"orgs\" (\n" +
+				"  \"id\" integer NOT NULL GENERATED BY DEFAULT AS IDENTITY,\n" +
+				"  \"name\" character varying(255) NOT NULL DEFAULT 'none'::character varying,\n" +
+				"  \"active\" boolean NOT NULL DEFAULT true,\n" +
+				"  \"created\" timestamp with time zone DEFAULT CURRENT_TIMESTAMP,\n" +
+				"  PRIMARY KEY (\"id\")\n)",
+			`CREATE INDEX "name_idx" ON "orgs" ("name")`,
+		}},
+		{"postgres", "mysql", postgresTables, []string{
+			"CREATE TABLE `orgs` (\n" +
+				"  `id` int NOT NULL auto_increment,\n" +
+				"  `name` varchar(255) NOT NULL DEFAULT 'none',\n" +
+				"  `active` tinyint(1) NOT NULL DEFAULT 1,\n" +
+				"  `created` timestamp DEFAULT CURRENT_TIMESTAMP,\n" +
+				"  PRIMARY KEY (`id`)\n)",
+			"CREATE INDEX `name_idx` ON `orgs` (`name`)",
+		}},
+	}
+	for _, c := range cases {
+		d, err := dialect.Get(c.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		from, err := dialect.Convert(c.from, c.to, c.tables)
+		if err != nil {
+			t.Fatalf("%s to %s: %v", c.from, c.to, err)
+		}
+		if stmts := Statements(d, from, nil); !slices.Equal(stmts, c.expected) {
+			t.Errorf("%s to %s: unexpected statements:\n%q\nexpected:\n%q", c.from, c.to, stmts, c.expected)
+		}
+	}
+
+	enum := []schema.Table{{Name: "orgs", Columns: []schema.Column{{Name: "kind", Type: "enum('a','b')"}}}}
+	if _, err := dialect.Convert("mysql", "postgres", enum); err == nil {
+		t.Error("expected an error for a type without a counterpart")
+	}
+}
+
+func TestWriteTrigger(t *testing.T) {
+	from := []schema.Table{{
+		Name:    "orders",
+		Columns: []schema.Column{{Name: "id", Type: "int", IsPrimary: true}, {Name: "total", Type: "int"}},
+		Triggers: []schema.Trigger{
+			{Name: "orders_total", Timing: "BEFORE", Event: "INSERT", SQL: "BEGIN\n  IF NEW.total < 0 THEN\n    SET NEW.total = 0;\n  END IF;\nEND"},
+			{Name: "orders_id", Timing: "BEFORE", Event: "UPDATE", SQL: "SET NEW.id = OLD.id"},
+		},
+	}}
+	to := []schema.Table{{Name: "orders", Columns: from[0].Columns}}
+	d, err := dialect.Get("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var script strings.Builder
+	if err = Write(&script, d, Statements(d, from, to)); err != nil {
+		t.Fatal(err)
+	}
+	// the compound body is run with another delimiter so the mysql client
+	// doesn't end the statement at its first semicolon
+	expected := "DELIMITER //\n" +
+		"CREATE TRIGGER `orders_total` BEFORE INSERT ON `orders` FOR EACH ROW BEGIN\n  IF NEW.total < 0 THEN\n    SET NEW.total = 0;\n  END IF;\nEND //\n" +
+		"DELIMITER ;\n" +
+		"CREATE TRIGGER `orders_id` BEFORE UPDATE ON `orders` FOR EACH ROW SET NEW.id = OLD.id;\n"
+	if script.String() != expected {
+		t.Errorf("unexpected script:\n%s\nexpected:\n%s", script.String(), expected)
+	}
+}
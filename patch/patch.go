@@ -0,0 +1,142 @@
+package patch
+
+import (
+	"fmt"
+	"strings"
+
+	"sqlcmp/compare"
+	"sqlcmp/datasource/dialect"
+)
+
+// Builder turns the row differences of a table into the statements that bring
+// `to` in line with `from`. Inserts and deletes are batched, updates are
+// written per row. Every statement can be applied more than once. Statements
+// are passed to emit with the kind of difference they fix, together with the
+// statements they have to be applied with. Deletes are always written before
+// the inserts of rows that were added after them, so they free up any unique
+// values the inserts need.
+type Builder struct {
+	dialect dialect.Dialect
+	table   compare.Table
+	// uniqueKey tells whether the key has a unique index, without which rows
+	// are deleted by key and inserted instead of upserted
+	uniqueKey bool
+	batchSize int
+	emit      func(kind compare.Kind, stmts ...string) error
+	inserts   []compare.Row
+	deletes   []compare.Row
+}
+
+func NewBuilder(d dialect.Dialect, table compare.Table, uniqueKey bool, batchSize int, emit func(kind compare.Kind, stmts ...string) error) *Builder {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &Builder{dialect: d, table: table, uniqueKey: uniqueKey, batchSize: batchSize, emit: emit}
+}
+
+// Add adds the statement for a difference, writing any batch that is full.
+func (b *Builder) Add(d compare.Difference) (err error) {
+	switch d.Kind {
+	case compare.OnlyInFrom:
+		b.inserts = append(b.inserts, d.From)
+		if len(b.inserts) >= b.batchSize {
+			return b.Flush()
+		}
+	case compare.OnlyInTo:
+		b.deletes = append(b.deletes, d.Key)
+		if len(b.deletes) >= b.batchSize {
+			return b.flushDeletes()
+		}
+	case compare.Changed:
+		return b.emit(compare.Changed, b.update(d))
+	}
+	return
+}
+
+// Flush writes the remaining batches, deletes first.
+func (b *Builder) Flush() (err error) {
+	if err = b.flushDeletes(); err != nil {
+		return
+	}
+	return b.flushInserts()
+}
+
+func (b *Builder) flushInserts() (err error) {
+	if len(b.inserts) == 0 {
+		return
+	}
+	rows := make([][]string, len(b.inserts))
+	keys := make([]compare.Row, len(b.inserts))
+	for i, row := range b.inserts {
+		rows[i] = b.quoteRow(row)
+		keys[i] = make(compare.Row, len(b.table.Key))
+		for j, k := range b.table.Key {
+			keys[i][j] = row[k]
+		}
+	}
+	b.inserts = b.inserts[:0]
+	if !b.uniqueKey {
+		return b.emit(compare.OnlyInFrom, b.delete(keys), b.dialect.Insert(b.table.Name, b.table.Columns, rows))
+	}
+	return b.emit(compare.OnlyInFrom, b.dialect.Upsert(b.table.Name, b.table.Columns, b.keyColumns(), rows))
+}
+
+func (b *Builder) flushDeletes() (err error) {
+	if len(b.deletes) == 0 {
+		return
+	}
+	stmt := b.delete(b.deletes)
+	b.deletes = b.deletes[:0]
+	return b.emit(compare.OnlyInTo, stmt)
+}
+
+// delete returns a DELETE of the rows with the keys.
+func (b *Builder) delete(keys []compare.Row) string {
+	var where string
+	if len(b.table.Key) == 1 {
+		values := make([]string, len(keys))
+		for i, key := range keys {
+			values[i] = b.dialect.QuoteValue(key[0])
+		}
+		where = fmt.Sprintf("%s IN (%s)", b.dialect.QuoteIdent(b.table.Columns[b.table.Key[0]]), strings.Join(values, ", "))
+	} else {
+		conds := make([]string, len(keys))
+		for i, key := range keys {
+			conds[i] = "(" + b.keyCondition(key) + ")"
+		}
+		where = strings.Join(conds, "\n  OR ")
+	}
+	return fmt.Sprintf("DELETE FROM %s WHERE %s", b.dialect.QuoteIdent(b.table.Name), where)
+}
+
+func (b *Builder) update(d compare.Difference) string {
+	sets := make([]string, len(d.Columns))
+	for i, c := range d.Columns {
+		sets[i] = fmt.Sprintf("%s = %s", b.dialect.QuoteIdent(b.table.Columns[c]), b.dialect.QuoteValue(d.From[c]))
+	}
+	return fmt.Sprintf("UPDATE %s SET %s WHERE %s", b.dialect.QuoteIdent(b.table.Name), strings.Join(sets, ", "), b.keyCondition(d.Key))
+}
+
+func (b *Builder) keyCondition(key compare.Row) string {
+	conds := make([]string, len(b.table.Key))
+	for i, k := range b.table.Key {
+		conds[i] = fmt.Sprintf("%s = %s", b.dialect.QuoteIdent(b.table.Columns[k]), b.dialect.QuoteValue(key[i]))
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func (b *Builder) keyColumns() []string {
+	cols := make([]string, len(b.table.Key))
+	for i, k := range b.table.Key {
+		cols[i] = b.table.Columns[k]
+	}
+	return cols
+}
+
+func (b *Builder) quoteRow(row compare.Row) []string {
+	quoted := make([]string, len(row))
+	for i, v := range row {
+		quoted[i] = b.dialect.QuoteValue(v)
+	}
+	return quoted
+}
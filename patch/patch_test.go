@@ -0,0 +1,84 @@
+package patch
+
+import (
+	"slices"
+	"testing"
+
+	"sqlcmp/compare"
+	"sqlcmp/datasource/dialect"
+)
+
+func row(values ...interface{}) compare.Row {
+	r := make(compare.Row, len(values))
+	for i, v := range values {
+		if v != nil {
+			r[i] = []byte(v.(string))
+		}
+	}
+	return r
+}
+
+func TestBuilder(t *testing.T) {
+	d, err := dialect.Get("mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := compare.Table{Name: "t", Columns: []string{"a", "b", "note"}, Key: []int{0, 1}}
+	var stmts []string
+	b := NewBuilder(d, table, true, 2, func(kind compare.Kind, stmt ...string) error {
+		stmts = append(stmts, stmt...)
+		return nil
+	})
+	diffs := []compare.Difference{
+		{Kind: compare.OnlyInFrom, Key: row("1", "1"), From: row("1", "1", `it's a \ test`)},
+		{Kind: compare.OnlyInTo, Key: row("1", "2"), To: row("1", "2", "x")},
+		{Kind: compare.Changed, Key: row("2", "1"), From: row("2", "1", nil), To: row("2", "1", "y"), Columns: []int{2}},
+		{Kind: compare.OnlyInFrom, Key: row("3", "1"), From: row("3", "1", "\xff")},
+		{Kind: compare.OnlyInTo, Key: row("4", "1"), To: row("4", "1", "z")},
+	}
+	for _, diff := range diffs {
+		if err = b.Add(diff); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"UPDATE `t` SET `note` = NULL WHERE `a` = '2' AND `b` = '1'",
+		// the pending delete goes before the full batch of inserts
+		"DELETE FROM `t` WHERE (`a` = '1' AND `b` = '2')",
+		"INSERT INTO `t` (`a`, `b`, `note`) VALUES\n  ('1', '1', 'it''s a \\\\ test'),\n  ('3', '1', X'ff')\nON DUPLICATE KEY UPDATE `note` = VALUES(`note`)",
+		"DELETE FROM `t` WHERE (`a` = '4' AND `b` = '1')",
+	}
+	if !slices.Equal(stmts, expected) {
+		t.Errorf("unexpected statements:\n%q\nexpected:\n%q", stmts, expected)
+	}
+}
+
+func TestBuilderWithoutUniqueKey(t *testing.T) {
+	d, err := dialect.Get("postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := compare.Table{Name: "t", Columns: []string{"code", "note"}, Key: []int{0}}
+	var batches [][]string
+	b := NewBuilder(d, table, false, 2, func(kind compare.Kind, stmts ...string) error {
+		batches = append(batches, stmts)
+		return nil
+	})
+	for _, code := range []string{"a", "b"} {
+		if err = b.Add(compare.Difference{Kind: compare.OnlyInFrom, Key: row(code), From: row(code, "x")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// ON CONFLICT needs a unique index on the key, so the rows are replaced in
+	// statements that are applied together
+	expected := []string{
+		`DELETE FROM "t" WHERE "code" IN ('a', 'b')`,
+		"INSERT INTO \"t\" (\"code\", \"note\") VALUES\n  ('a', 'x'),\n  ('b', 'x')",
+	}
+	if len(batches) != 1 || !slices.Equal(batches[0], expected) {
+		t.Errorf("unexpected statements:\n%q\nexpected:\n%q", batches, expected)
+	}
+}
@@ -0,0 +1,306 @@
+package report
+
+import (
+	"encoding/hex"
+	"html/template"
+	"io"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"sqlcmp/compare"
+)
+
+// Run describes the diff an HTML report was made for.
+type Run struct {
+	// From and To are the redacted dsns of the sources
+	From, To      string
+	Started       time.Time
+	Finished      time.Time
+	Mode          string
+	IncludeTables []string
+	ExcludeTables []string
+	// Snapshots is set when the sources were read from consistent snapshots
+	Snapshots *Snapshots
+}
+
+// HTML collects the results of a diff and writes them as a single HTML page
+// without external assets when it ends. Unlike the other formats it keeps the
+// report in memory, so at most MaxRows differences are kept for each table.
+type HTML struct {
+	w       io.Writer
+	run     Run
+	maxRows int
+
+	mu         sync.Mutex
+	onlyInFrom []string
+	onlyInTo   []string
+	tables     []*htmlTable
+}
+
+func NewHTML(w io.Writer, run Run, maxRows int) *HTML {
+	return &HTML{w: w, run: run, maxRows: maxRows}
+}
+
+func (h *HTML) Begin(onlyInFrom, onlyInTo []string) error {
+	h.onlyInFrom, h.onlyInTo = onlyInFrom, onlyInTo
+	return nil
+}
+
+// Table returns the writer of a table, it's safe to call from several
+// goroutines.
+func (h *HTML) Table() TableWriter {
+	t := &htmlTable{maxRows: h.maxRows}
+	h.mu.Lock()
+	h.tables = append(h.tables, t)
+	h.mu.Unlock()
+	return t
+}
+
+func (h *HTML) End(err error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	page := htmlPage{Run: h.run, OnlyInFromTables: h.onlyInFrom, OnlyInToTables: h.onlyInTo}
+	if page.Run.Finished.IsZero() {
+		page.Run.Finished = time.Now()
+	}
+	if err != nil {
+		page.Error = err.Error()
+	}
+	for _, t := range h.tables {
+		if t.started {
+			page.Tables = append(page.Tables, t)
+		}
+	}
+	sort.SliceStable(page.Tables, func(i, j int) bool { return page.Tables[i].Name < page.Tables[j].Name })
+	for _, t := range page.Tables {
+		if len(t.OnlyInFromColumns) > 0 || len(t.OnlyInToColumns) > 0 {
+			page.SchemaMismatches = append(page.SchemaMismatches, t)
+		}
+	}
+	return htmlTemplate.Execute(h.w, page)
+}
+
+type htmlPage struct {
+	Run              Run
+	Error            string
+	OnlyInFromTables []string
+	OnlyInToTables   []string
+	Tables           []*htmlTable
+	SchemaMismatches []*htmlTable
+}
+
+type htmlTable struct {
+	Table
+	Counts      compare.Counts
+	Error       string
+	Differences []Difference
+	// Omitted is the number of differences over maxRows
+	Omitted int64
+
+	maxRows int
+	started bool
+}
+
+func (t *htmlTable) Start(table Table) error {
+	t.Table, t.started = table, true
+	return nil
+}
+
+func (t *htmlTable) Difference(d Difference) error {
+	if t.maxRows > 0 && len(t.Differences) >= t.maxRows {
+		t.Omitted++
+		return nil
+	}
+	t.Differences = append(t.Differences, d)
+	return nil
+}
+
+func (t *htmlTable) Done(counts compare.Counts, err error) error {
+	t.Counts = counts
+	if err != nil {
+		t.Error = err.Error()
+	}
+	return nil
+}
+
+// htmlCell is a column of a difference shown side by side.
+type htmlCell struct {
+	Column   string
+	From, To Value
+	// InFrom and InTo are false when the row doesn't exist on that side
+	InFrom, InTo bool
+}
+
+// cells lines up the from and to values of a difference by column.
+func cells(d Difference) (cells []htmlCell) {
+	switch d.Kind {
+	case compare.OnlyInFrom:
+		for _, f := range d.From {
+			cells = append(cells, htmlCell{Column: f.Column, From: f.Value, InFrom: true})
+		}
+	case compare.OnlyInTo:
+		for _, f := range d.To {
+			cells = append(cells, htmlCell{Column: f.Column, To: f.Value, InTo: true})
+		}
+	case compare.Changed:
+		for i, f := range d.From {
+			cells = append(cells, htmlCell{Column: f.Column, From: f.Value, To: d.To[i].Value, InFrom: true, InTo: true})
+		}
+	}
+	return
+}
+
+// displayValue shows a value the way people expect to read it, binary values
+// are shown as hex.
+func displayValue(v Value) template.HTML {
+	switch {
+	case v == nil:
+		return `<span class="null">NULL</span>`
+	case utf8.Valid(v):
+		return template.HTML(template.HTMLEscapeString(string(v)))
+	}
+	return template.HTML("0x" + hex.EncodeToString(v))
+}
+
+func kindLabel(k compare.Kind) string {
+	switch k {
+	case compare.OnlyInFrom:
+		return "only in from"
+	case compare.OnlyInTo:
+		return "only in to"
+	}
+	return "changed"
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"cells": cells,
+	"kind":  kindLabel,
+	"value": displayValue,
+	"time":  func(t time.Time) string { return t.Format(time.RFC3339) },
+	"took":  func(r Run) string { return r.Finished.Sub(r.Started).Round(time.Millisecond).String() },
+}).Parse(htmlSource))
+
+const htmlSource = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>sqlcmp diff report</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: .5em 0 1em; }
+th, td { border: 1px solid #ccc; padding: .25em .6em; text-align: left; vertical-align: top; }
+th { background: #f3f3f3; }
+td.number { text-align: right; }
+dt { font-weight: bold; float: left; clear: left; width: 8em; }
+dd { margin-left: 9em; }
+code, .value { font-family: ui-monospace, monospace; white-space: pre-wrap; }
+.ok { color: #1a7f37; }
+.differs, .error { color: #cf222e; }
+.null { color: #888; font-style: italic; }
+.missing { background: #f6f6f6; }
+td.from { background: #ffebe9; }
+td.to { background: #dafbe1; }
+details { margin: .5em 0; }
+summary { cursor: pointer; }
+.difference { margin-left: 1.5em; }
+</style>
+</head>
+<body>
+<h1>sqlcmp diff report</h1>
+
+<h2>Run</h2>
+<dl>
+<dt>From</dt><dd><code>{{.Run.From}}</code></dd>
+<dt>To</dt><dd><code>{{.Run.To}}</code></dd>
+<dt>Started</dt><dd>{{time .Run.Started}}</dd>
+<dt>Took</dt><dd>{{took .Run}}</dd>
+{{- with .Run.Mode}}
+<dt>Mode</dt><dd>{{.}}</dd>
+{{- end}}
+{{- with .Run.IncludeTables}}
+<dt>Tables</dt><dd>{{range $i, $t := .}}{{if $i}}, {{end}}<code>{{$t}}</code>{{end}}</dd>
+{{- end}}
+{{- with .Run.ExcludeTables}}
+<dt>Excluded</dt><dd>{{range $i, $t := .}}{{if $i}}, {{end}}<code>{{$t}}</code>{{end}}</dd>
+{{- end}}
+{{- with .Run.Snapshots}}
+<dt>From snapshot</dt><dd><code>{{.From}}</code></dd>
+<dt>To snapshot</dt><dd><code>{{.To}}</code></dd>
+{{- end}}
+</dl>
+{{- with .Error}}
+<p class="error">The diff stopped early: <code>{{.}}</code></p>
+{{- end}}
+
+<h2>Summary</h2>
+<table>
+<tr><th>Table</th><th>Key</th><th>Matched</th><th>Only in from</th><th>Only in to</th><th>Changed</th><th>Result</th></tr>
+{{- range .Tables}}
+<tr>
+<td><a href="#table-{{.Name}}">{{.Name}}</a></td>
+<td>{{if .Key}}{{range $i, $c := .Key}}{{if $i}}, {{end}}{{$c}}{{end}}{{else}}<span class="null">none</span>{{end}}</td>
+<td class="number">{{.Counts.Matched}}</td>
+<td class="number">{{.Counts.OnlyInFrom}}</td>
+<td class="number">{{.Counts.OnlyInTo}}</td>
+<td class="number">{{.Counts.Changed}}</td>
+<td>{{if .Error}}<span class="error">failed</span>{{else if .Counts.Differences}}<span class="differs">differs</span>{{else}}<span class="ok">matches</span>{{end}}</td>
+</tr>
+{{- else}}
+<tr><td colspan="7">No tables were compared.</td></tr>
+{{- end}}
+</table>
+
+<h2>Schema mismatches</h2>
+{{- if or .OnlyInFromTables .OnlyInToTables .SchemaMismatches}}
+<ul>
+{{- range .OnlyInFromTables}}
+<li>table <code>{{.}}</code> only exists in from</li>
+{{- end}}
+{{- range .OnlyInToTables}}
+<li>table <code>{{.}}</code> only exists in to</li>
+{{- end}}
+{{- range .SchemaMismatches}}
+{{- $table := .Name}}
+{{- range .OnlyInFromColumns}}
+<li>column <code>{{$table}}.{{.}}</code> only exists in from</li>
+{{- end}}
+{{- range .OnlyInToColumns}}
+<li>column <code>{{$table}}.{{.}}</code> only exists in to</li>
+{{- end}}
+{{- end}}
+</ul>
+{{- else}}
+<p class="ok">The compared tables and columns exist on both sides.</p>
+{{- end}}
+
+<h2>Differences</h2>
+{{- range .Tables}}
+<details id="table-{{.Name}}"{{if .Error}} open{{end}}>
+<summary><strong>{{.Name}}</strong>: {{.Counts.Differences}} rows differ{{if .Omitted}}, the first {{len .Differences}} are shown{{end}}</summary>
+{{- with .Error}}
+<p class="error"><code>{{.}}</code></p>
+{{- end}}
+{{- range .Differences}}
+<details class="difference">
+<summary>{{kind .Kind}}
+{{- if .Key}} ({{range $i, $f := .Key}}{{if $i}}, {{end}}{{$f.Column}}={{value $f.Value}}{{end}}){{end}}
+{{- if gt .Count 1}}, {{.Count}} times{{end}}</summary>
+<table>
+<tr><th>Column</th><th>From</th><th>To</th></tr>
+{{- range cells .}}
+<tr>
+<th>{{.Column}}</th>
+{{- if .InFrom}}<td class="from value">{{value .From}}</td>{{else}}<td class="missing"></td>{{end}}
+{{- if .InTo}}<td class="to value">{{value .To}}</td>{{else}}<td class="missing"></td>{{end}}
+</tr>
+{{- end}}
+</table>
+</details>
+{{- end}}
+</details>
+{{- end}}
+</body>
+</html>
+`
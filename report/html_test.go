@@ -0,0 +1,36 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTML(t *testing.T) {
+	var buf bytes.Buffer
+	started := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	html := NewHTML(&buf, Run{From: "postgres://user:***@db/app", To: "sqlite3://<copy>.db", Started: started, Finished: started.Add(time.Second)}, 1)
+	writeTables(t, html, html.Table, errors.New("interrupted"))
+	page := buf.String()
+	for _, expected := range []string{
+		"postgres://user:***@db/app",
+		"sqlite3://&lt;copy&gt;.db",
+		"table <code>orders</code> only exists in from",
+		"column <code>users.email</code> only exists in to",
+		"The diff stopped early: <code>interrupted</code>",
+		`<td class="from value">ann</td>`,
+		`<td class="from value"><span class="null">NULL</span></td>`,
+		"2 rows differ, the first 1 are shown",
+	} {
+		if !strings.Contains(page, expected) {
+			t.Errorf("expected the report to contain %s", expected)
+		}
+	}
+	for _, external := range []string{"http://", "https://", "<script", "<link"} {
+		if strings.Contains(page, external) {
+			t.Errorf("expected the report not to load anything, found %s", external)
+		}
+	}
+}
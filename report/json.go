@@ -0,0 +1,238 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+
+	"sqlcmp/compare"
+)
+
+// JSON writes the report as a single document that is streamed as the tables
+// are compared:
+//
+//	{"snapshots": {...}, "only_in_from_tables": [...], "only_in_to_tables": [...], "tables": [
+//	  {"name": ..., "key": [...], ..., "differences": [...], "counts": {...}},
+//	  ...
+//	], "error": ...}
+type JSON struct {
+	// Snapshots is written when it's set before Begin
+	Snapshots *Snapshots
+
+	w      io.Writer
+	tables *elementWriter
+}
+
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{w: w, tables: &elementWriter{w: w}}
+}
+
+func (j *JSON) Begin(onlyInFrom, onlyInTo []string) error {
+	if j.Snapshots != nil {
+		if err := writeJSON(j.w, raw(`{"snapshots":`), j.Snapshots, raw(",")); err != nil {
+			return err
+		}
+	} else if err := writeJSON(j.w, raw("{")); err != nil {
+		return err
+	}
+	return writeJSON(j.w, raw(`"only_in_from_tables":`), nonNil(onlyInFrom), raw(`,"only_in_to_tables":`), nonNil(onlyInTo), raw(`,"tables":[`+"\n"))
+}
+
+func (j *JSON) Output() io.Writer {
+	return j.tables
+}
+
+func (j *JSON) Table(w io.Writer) TableWriter {
+	return &jsonTable{w: w}
+}
+
+func (j *JSON) End(err error) error {
+	if err != nil {
+		return writeJSON(j.w, raw(`],"error":`), err.Error(), raw("}\n"))
+	}
+	return writeJSON(j.w, raw("]}\n"))
+}
+
+// elementWriter drops the comma every table starts with from the first table
+// written so the tables can be written without knowing which comes first.
+type elementWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (e *elementWriter) Write(p []byte) (n int, err error) {
+	if !e.started && len(p) > 0 {
+		e.started = true
+		if p[0] == ',' {
+			n, err = e.w.Write(p[1:])
+			return n + 1, err
+		}
+	}
+	return e.w.Write(p)
+}
+
+type jsonTable struct {
+	w           io.Writer
+	differences int
+}
+
+func (t *jsonTable) Start(table Table) error {
+	table.Key = nonNil(table.Key)
+	table.OnlyInFromColumns = nonNil(table.OnlyInFromColumns)
+	table.OnlyInToColumns = nonNil(table.OnlyInToColumns)
+	header, err := json.Marshal(table)
+	if err != nil {
+		return err
+	}
+	// leave the object open for the differences
+	return writeJSON(t.w, raw(","), raw(header[:len(header)-1]), raw(`,"differences":[`+"\n"))
+}
+
+func (t *jsonTable) Difference(d Difference) error {
+	sep := raw("")
+	if t.differences > 0 {
+		sep = ","
+	}
+	t.differences++
+	return writeJSON(t.w, sep, d, raw("\n"))
+}
+
+func (t *jsonTable) Done(counts compare.Counts, failure error) error {
+	if failure != nil {
+		return writeJSON(t.w, raw(`],"counts":`), counts, raw(`,"error":`), failure.Error(), raw("}\n"))
+	}
+	return writeJSON(t.w, raw(`],"counts":`), counts, raw("}\n"))
+}
+
+// NDJSON writes a JSON object per line for every table that exists on one
+// side only, every difference and every table that was compared:
+//
+//	{"type": "snapshots", "from": ..., "to": ...}
+//	{"type": "only_in_from_table", "table": ...}
+//	{"type": "only_in_to_table", "table": ...}
+//	{"type": "difference", "table": ..., "kind": ..., "key": {...}, "from": {...}, "to": {...}}
+//	{"type": "table", "name": ..., "key": [...], ..., "counts": {...}}
+//	{"type": "error", "error": ...}
+type NDJSON struct {
+	// Snapshots is written when it's set before Begin
+	Snapshots *Snapshots
+
+	w io.Writer
+}
+
+func NewNDJSON(w io.Writer) *NDJSON {
+	return &NDJSON{w: w}
+}
+
+type ndjsonTableName struct {
+	Type  string `json:"type"`
+	Table string `json:"table"`
+}
+
+func (n *NDJSON) Begin(onlyInFrom, onlyInTo []string) (err error) {
+	if n.Snapshots != nil {
+		if err = writeLine(n.w, struct {
+			Type string `json:"type"`
+			*Snapshots
+		}{"snapshots", n.Snapshots}); err != nil {
+			return
+		}
+	}
+	for _, table := range onlyInFrom {
+		if err = writeLine(n.w, ndjsonTableName{"only_in_from_table", table}); err != nil {
+			return
+		}
+	}
+	for _, table := range onlyInTo {
+		if err = writeLine(n.w, ndjsonTableName{"only_in_to_table", table}); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (n *NDJSON) Output() io.Writer {
+	return n.w
+}
+
+func (n *NDJSON) Table(w io.Writer) TableWriter {
+	return &ndjsonTable{w: w}
+}
+
+func (n *NDJSON) End(err error) error {
+	if err == nil {
+		return nil
+	}
+	return writeLine(n.w, struct {
+		Type  string `json:"type"`
+		Error string `json:"error"`
+	}{"error", err.Error()})
+}
+
+type ndjsonTable struct {
+	w     io.Writer
+	table Table
+}
+
+func (t *ndjsonTable) Start(table Table) error {
+	table.Key = nonNil(table.Key)
+	table.OnlyInFromColumns = nonNil(table.OnlyInFromColumns)
+	table.OnlyInToColumns = nonNil(table.OnlyInToColumns)
+	t.table = table
+	return nil
+}
+
+func (t *ndjsonTable) Difference(d Difference) error {
+	return writeLine(t.w, struct {
+		Type  string `json:"type"`
+		Table string `json:"table"`
+		Difference
+	}{"difference", t.table.Name, d})
+}
+
+func (t *ndjsonTable) Done(counts compare.Counts, failure error) error {
+	line := struct {
+		Type string `json:"type"`
+		Table
+		Counts compare.Counts `json:"counts"`
+		Error  string         `json:"error,omitempty"`
+	}{Type: "table", Table: t.table, Counts: counts}
+	if failure != nil {
+		line.Error = failure.Error()
+	}
+	return writeLine(t.w, line)
+}
+
+// raw is written by writeJSON as it is
+type raw string
+
+// writeJSON writes raw parts as they are and marshals everything else.
+func writeJSON(w io.Writer, parts ...interface{}) (err error) {
+	for _, part := range parts {
+		var b []byte
+		if r, ok := part.(raw); ok {
+			b = []byte(r)
+		} else if b, err = json.Marshal(part); err != nil {
+			return
+		}
+		if _, err = w.Write(b); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func writeLine(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func nonNil(items []string) []string {
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
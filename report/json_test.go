@@ -0,0 +1,118 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"sqlcmp/compare"
+)
+
+var testTable = compare.Table{Name: "users", Columns: []string{"id", "name", "avatar"}, Key: []int{0}}
+
+// writeTables writes the same two tables to a report, the second one fails with
+// failure.
+func writeTables(t *testing.T, format interface {
+	Begin(onlyInFrom, onlyInTo []string) error
+	End(err error) error
+}, newTable func() TableWriter, failure error) {
+	t.Helper()
+	if err := format.Begin([]string{"orders"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"users", "teams"} {
+		table := newTable()
+		if err := table.Start(Table{Name: name, Key: []string{"id"}, OnlyInToColumns: []string{"email"}}); err != nil {
+			t.Fatal(err)
+		}
+		differences := []compare.Difference{
+			{Kind: compare.OnlyInFrom, Key: compare.Row{[]byte("1")}, From: compare.Row{[]byte("1"), []byte("ann"), nil}},
+			{Kind: compare.Changed, Key: compare.Row{[]byte("2")}, From: compare.Row{[]byte("2"), []byte("bob"), {0xff}}, To: compare.Row{[]byte("2"), []byte("bob"), {0xfe}}, Columns: []int{2}},
+		}
+		for _, d := range differences {
+			if err := table.Difference(NewDifference(testTable, d)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var err error
+		if name == "teams" {
+			err = failure
+		}
+		if err := table.Done(compare.Counts{Matched: 3, OnlyInFrom: 1, Changed: 1}, err); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := format.End(failure); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	format := NewJSON(&buf)
+	writeTables(t, format, func() TableWriter { return format.Table(format.Output()) }, errors.New("interrupted"))
+	var doc struct {
+		OnlyInFromTables []string `json:"only_in_from_tables"`
+		OnlyInToTables   []string `json:"only_in_to_tables"`
+		Tables           []struct {
+			Name            string                       `json:"name"`
+			OnlyInToColumns []string                     `json:"only_in_to_columns"`
+			Differences     []map[string]json.RawMessage `json:"differences"`
+			Counts          compare.Counts               `json:"counts"`
+			Error           string                       `json:"error"`
+		} `json:"tables"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON %s: %v", buf.String(), err)
+	}
+	if len(doc.OnlyInFromTables) != 1 || doc.OnlyInToTables == nil || doc.Error != "interrupted" {
+		t.Errorf("unexpected tables or error: %s", buf.String())
+	}
+	if len(doc.Tables) != 2 || doc.Tables[0].Error != "" || doc.Tables[1].Error != "interrupted" {
+		t.Fatalf("unexpected tables: %s", buf.String())
+	}
+	users := doc.Tables[0]
+	if users.Counts.Matched != 3 || len(users.OnlyInToColumns) != 1 || len(users.Differences) != 2 {
+		t.Errorf("unexpected table: %s", buf.String())
+	}
+	expected := []map[string]string{
+		{"kind": `"only_in_from"`, "key": `{"id":"1"}`, "from": `{"id":"1","name":"ann","avatar":null}`},
+		{"kind": `"changed"`, "key": `{"id":"2"}`, "from": `{"avatar":{"hex":"ff"}}`, "to": `{"avatar":{"hex":"fe"}}`},
+	}
+	for i, d := range users.Differences {
+		if len(d) != len(expected[i]) {
+			t.Errorf("difference %d: expected %v, got %v", i, expected[i], d)
+		}
+		for field, value := range expected[i] {
+			if string(d[field]) != value {
+				t.Errorf("difference %d: expected %s to be %s, got %s", i, field, value, d[field])
+			}
+		}
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	format := NewNDJSON(&buf)
+	format.Snapshots = &Snapshots{From: "2024-01-02 03:04:05", To: "2024-01-02 03:04:06"}
+	writeTables(t, format, func() TableWriter { return format.Table(format.Output()) }, nil)
+	var types []string
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		var v struct {
+			Type  string `json:"type"`
+			Table string `json:"table"`
+			Name  string `json:"name"`
+		}
+		if err := json.Unmarshal([]byte(line), &v); err != nil {
+			t.Fatalf("invalid line %s: %v", line, err)
+		}
+		types = append(types, v.Type+":"+v.Table+v.Name)
+	}
+	expected := "snapshots: only_in_from_table:orders difference:users difference:users table:users difference:teams difference:teams table:teams"
+	if strings.Join(types, " ") != expected {
+		t.Errorf("expected %s, got %s", expected, strings.Join(types, " "))
+	}
+}
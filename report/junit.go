@@ -0,0 +1,203 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"sqlcmp/compare"
+)
+
+// junitMaxRows is the number of differences listed in the failure of a table.
+const junitMaxRows = 100
+
+// TestCase is a check that's reported as a JUnit test case. It passes when
+// Failure and Error are empty.
+type TestCase struct {
+	Name string
+	// Class groups the test cases, CI tools usually show it as the package
+	Class    string
+	Duration time.Duration
+	// Failure is a short description of what the check found and Details the
+	// findings themselves
+	Failure string
+	Details string
+	// Error is set when the check couldn't run
+	Error string
+}
+
+// JUnit collects the checks of a command and writes them as a JUnit XML test
+// suite when it ends, so CI can show each table or foreign key as a test.
+type JUnit struct {
+	w       io.Writer
+	suite   string
+	started time.Time
+
+	mu    sync.Mutex
+	cases []*TestCase
+}
+
+func NewJUnit(w io.Writer, suite string) *JUnit {
+	return &JUnit{w: w, suite: suite, started: time.Now()}
+}
+
+// Add records a test case, it's safe to call from several goroutines.
+func (j *JUnit) Add(c TestCase) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cases = append(j.cases, &c)
+}
+
+// Begin records the tables that exist on one side only as failed tests.
+func (j *JUnit) Begin(onlyInFrom, onlyInTo []string) error {
+	for _, table := range onlyInFrom {
+		j.Add(TestCase{Name: table, Class: j.suite, Failure: "table only exists in from"})
+	}
+	for _, table := range onlyInTo {
+		j.Add(TestCase{Name: table, Class: j.suite, Failure: "table only exists in to"})
+	}
+	return nil
+}
+
+// Table returns a writer that records a table of a diff as a test case which
+// fails when the table has differences or columns that exist on one side only,
+// listing the first of them.
+func (j *JUnit) Table() TableWriter {
+	return &junitTable{junit: j}
+}
+
+// End writes the test suite. err is the error that stopped the command, it's
+// recorded as an extra test case.
+func (j *JUnit) End(err error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	suite := junitSuite{Name: j.suite, Timestamp: j.started.UTC().Format("2006-01-02T15:04:05"), Time: seconds(time.Since(j.started))}
+	// tables that are compared in parallel finish in any order
+	cases := append([]*TestCase{}, j.cases...)
+	sort.SliceStable(cases, func(a, b int) bool {
+		if cases[a].Class != cases[b].Class {
+			return cases[a].Class < cases[b].Class
+		}
+		return cases[a].Name < cases[b].Name
+	})
+	if err != nil {
+		cases = append(cases, &TestCase{Name: "run", Class: j.suite, Error: err.Error()})
+	}
+	for _, c := range cases {
+		tc := junitCase{Name: c.Name, Class: c.Class, Time: seconds(c.Duration)}
+		switch {
+		case c.Error != "":
+			tc.Error = &junitMessage{Message: c.Error, Type: "error", Text: c.Details}
+			suite.Errors++
+		case c.Failure != "":
+			tc.Failure = &junitMessage{Message: c.Failure, Type: "failure", Text: c.Details}
+			suite.Failures++
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Tests = len(suite.Cases)
+	if _, err = io.WriteString(j.w, xml.Header); err != nil {
+		return err
+	}
+	e := xml.NewEncoder(j.w)
+	e.Indent("", "  ")
+	if err = e.Encode(junitSuites{Suites: []junitSuite{suite}}); err != nil {
+		return err
+	}
+	_, err = io.WriteString(j.w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name    string        `xml:"name,attr"`
+	Class   string        `xml:"classname,attr"`
+	Time    string        `xml:"time,attr"`
+	Failure *junitMessage `xml:"failure,omitempty"`
+	Error   *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+// junitTable lists the differences of a table in the text format.
+type junitTable struct {
+	junit       *JUnit
+	started     time.Time
+	text        textTable
+	details     bytes.Buffer
+	differences int
+}
+
+func (t *junitTable) Start(table Table) error {
+	t.started = time.Now()
+	t.text = textTable{w: &t.details}
+	for _, col := range table.OnlyInFromColumns {
+		fmt.Fprintf(&t.details, "- `%s` column `%s` only in from\n", table.Name, col)
+	}
+	for _, col := range table.OnlyInToColumns {
+		fmt.Fprintf(&t.details, "+ `%s` column `%s` only in to\n", table.Name, col)
+	}
+	return t.text.Start(table)
+}
+
+func (t *junitTable) Difference(d Difference) error {
+	if t.differences++; t.differences > junitMaxRows {
+		return nil
+	}
+	return t.text.Difference(d)
+}
+
+func (t *junitTable) Done(counts compare.Counts, err error) error {
+	c := TestCase{Name: t.text.table.Name, Class: t.junit.suite, Duration: time.Since(t.started)}
+	if t.differences > junitMaxRows {
+		fmt.Fprintf(&t.details, "... %d more differences\n", t.differences-junitMaxRows)
+	}
+	table := t.text.table
+	failures := []string{}
+	if counts.Differences() > 0 {
+		failures = append(failures, fmt.Sprintf("%d only in from, %d only in to, %d changed", counts.OnlyInFrom, counts.OnlyInTo, counts.Changed))
+	}
+	if len(table.OnlyInFromColumns) > 0 {
+		failures = append(failures, "columns only in from: "+strings.Join(table.OnlyInFromColumns, ", "))
+	}
+	if len(table.OnlyInToColumns) > 0 {
+		failures = append(failures, "columns only in to: "+strings.Join(table.OnlyInToColumns, ", "))
+	}
+	if err != nil {
+		c.Error = err.Error()
+	} else {
+		c.Failure = strings.Join(failures, "; ")
+	}
+	if c.Error != "" || c.Failure != "" {
+		c.Details = t.details.String()
+	}
+	t.junit.Add(c)
+	return nil
+}
@@ -0,0 +1,67 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	"sqlcmp/compare"
+)
+
+func TestJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	junit := NewJUnit(&buf, "diff")
+	junit.Add(TestCase{Name: "accounts", Class: "diff"})
+	writeTables(t, junit, junit.Table, errors.New("interrupted"))
+	var suites junitSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("invalid XML %s: %v", buf.String(), err)
+	}
+	if len(suites.Suites) != 1 {
+		t.Fatalf("expected a suite, got %s", buf.String())
+	}
+	suite := suites.Suites[0]
+	if suite.Tests != 5 || suite.Failures != 2 || suite.Errors != 2 {
+		t.Errorf("expected 5 tests, 2 failures and 2 errors, got %d, %d and %d", suite.Tests, suite.Failures, suite.Errors)
+	}
+	names := []string{}
+	for _, c := range suite.Cases {
+		names = append(names, c.Name)
+	}
+	if strings.Join(names, " ") != "accounts orders teams users run" {
+		t.Errorf("expected the tables in order and the run last, got %v", names)
+	}
+	if users := suite.Cases[3]; users.Failure == nil || users.Failure.Message != "1 only in from, 0 only in to, 1 changed; columns only in to: email" ||
+		!strings.Contains(users.Failure.Text, "- `users` (id=\"1\") only in from") {
+		t.Errorf("expected users to fail with its differences, got %+v", users.Failure)
+	}
+	if teams := suite.Cases[2]; teams.Error == nil || teams.Error.Message != "interrupted" {
+		t.Errorf("expected teams to fail with an error, got %+v", teams.Error)
+	}
+}
+
+func TestJUnitColumns(t *testing.T) {
+	var buf bytes.Buffer
+	junit := NewJUnit(&buf, "diff")
+	table := junit.Table()
+	if err := table.Start(Table{Name: "users", Key: []string{"id"}, OnlyInFromColumns: []string{"email"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.Done(compare.Counts{Matched: 3}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := junit.End(nil); err != nil {
+		t.Fatal(err)
+	}
+	var suites junitSuites
+	if err := xml.Unmarshal(buf.Bytes(), &suites); err != nil {
+		t.Fatalf("invalid XML %s: %v", buf.String(), err)
+	}
+	// a table whose rows match still fails on its columns
+	users := suites.Suites[0].Cases[0]
+	if users.Failure == nil || users.Failure.Message != "columns only in from: email" || !strings.Contains(users.Failure.Text, "- `users` column `email` only in from") {
+		t.Errorf("expected users to fail on its columns, got %+v", users.Failure)
+	}
+}
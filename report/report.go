@@ -0,0 +1,173 @@
+package report
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"unicode/utf8"
+
+	"sqlcmp/compare"
+)
+
+// Format writes the results of a diff to the writer it was created with. Each
+// table is written by its own TableWriter. When tables are compared in parallel
+// their output is buffered and copied to Output in order, otherwise the
+// TableWriters write to Output directly.
+type Format interface {
+	// Begin starts the report with the tables that exist on one side only
+	Begin(onlyInFrom, onlyInTo []string) error
+	Output() io.Writer
+	Table(w io.Writer) TableWriter
+	// End finishes the report, recording the error that stopped the diff early
+	End(err error) error
+}
+
+type TableWriter interface {
+	Start(t Table) error
+	Difference(d Difference) error
+	// Done ends the table, err is set when the comparison failed part way
+	Done(counts compare.Counts, err error) error
+}
+
+// Snapshots holds the points in time that the sources were read at with
+// --consistent-snapshot, e.g. a timestamp or GTID set.
+type Snapshots struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Table describes how a table was compared.
+type Table struct {
+	Name string `json:"name"`
+	// Key holds the columns that identify the rows, it's empty when the table is
+	// compared as a multiset
+	Key []string `json:"key"`
+	// OnlyInFromColumns and OnlyInToColumns are not compared
+	OnlyInFromColumns []string `json:"only_in_from_columns"`
+	OnlyInToColumns   []string `json:"only_in_to_columns"`
+}
+
+// Value is a column value. It's written to JSON as null, as a string, or as
+// {"hex": "..."} when it isn't valid UTF-8.
+type Value []byte
+
+func (v Value) MarshalJSON() ([]byte, error) {
+	switch {
+	case v == nil:
+		return []byte("null"), nil
+	case utf8.Valid(v):
+		return json.Marshal(string(v))
+	}
+	return json.Marshal(map[string]string{"hex": hex.EncodeToString(v)})
+}
+
+type Field struct {
+	Column string
+	Value  Value
+}
+
+// Row holds the values of some of the columns of a row in column order. It's
+// written to JSON as an object.
+type Row []Field
+
+func (r Row) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range r {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		column, err := json.Marshal(f.Column)
+		if err != nil {
+			return nil, err
+		}
+		value, err := f.Value.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(column)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// Difference is a row that differs. From and To hold the whole row when it only
+// exists on one side and only the columns that differ when it changed.
+type Difference struct {
+	Kind compare.Kind `json:"kind"`
+	Key  Row          `json:"key"`
+	From Row          `json:"from,omitempty"`
+	To   Row          `json:"to,omitempty"`
+	// Count is the number of extra copies of a row of a table without a key
+	Count int64 `json:"count,omitempty"`
+}
+
+func NewDifference(table compare.Table, d compare.Difference) Difference {
+	diff := Difference{Kind: d.Kind, Key: Row{}, Count: d.Count}
+	for i, k := range table.Key {
+		diff.Key = append(diff.Key, Field{table.Columns[k], d.Key[i]})
+	}
+	switch d.Kind {
+	case compare.OnlyInFrom:
+		diff.From = row(table.Columns, d.From, nil)
+	case compare.OnlyInTo:
+		diff.To = row(table.Columns, d.To, nil)
+	case compare.Changed:
+		diff.From = row(table.Columns, d.From, d.Columns)
+		diff.To = row(table.Columns, d.To, d.Columns)
+	}
+	return diff
+}
+
+// row returns the given columns of values, or all of them when indexes is nil.
+func row(columns []string, values compare.Row, indexes []int) (r Row) {
+	if indexes == nil {
+		r = make(Row, len(columns))
+		for i, col := range columns {
+			r[i] = Field{col, values[i]}
+		}
+		return
+	}
+	r = make(Row, len(indexes))
+	for i, c := range indexes {
+		r[i] = Field{columns[c], values[c]}
+	}
+	return
+}
+
+// Multi writes a table to every writer.
+func Multi(writers ...TableWriter) TableWriter {
+	return multiWriter(writers)
+}
+
+type multiWriter []TableWriter
+
+func (m multiWriter) Start(t Table) (err error) {
+	for _, w := range m {
+		if err = w.Start(t); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (m multiWriter) Difference(d Difference) (err error) {
+	for _, w := range m {
+		if err = w.Difference(d); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (m multiWriter) Done(counts compare.Counts, failure error) (err error) {
+	for _, w := range m {
+		if doneErr := w.Done(counts, failure); err == nil {
+			err = doneErr
+		}
+	}
+	return
+}
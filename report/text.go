@@ -0,0 +1,95 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"sqlcmp/compare"
+)
+
+// Text writes a line for every difference and a summary line for every table.
+// Tables that exist on one side only and errors are left to the caller.
+type Text struct {
+	w io.Writer
+}
+
+func NewText(w io.Writer) *Text {
+	return &Text{w: w}
+}
+
+func (t *Text) Begin(onlyInFrom, onlyInTo []string) error {
+	return nil
+}
+
+func (t *Text) Output() io.Writer {
+	return t.w
+}
+
+func (t *Text) Table(w io.Writer) TableWriter {
+	return &textTable{w: w}
+}
+
+func (t *Text) End(err error) error {
+	return nil
+}
+
+type textTable struct {
+	w     io.Writer
+	table Table
+}
+
+func (t *textTable) Start(table Table) error {
+	t.table = table
+	return nil
+}
+
+func (t *textTable) Difference(d Difference) (err error) {
+	key, copies := d.Key, ""
+	if len(key) == 0 {
+		// rows of tables without a key are identified by all of their values
+		if key = d.From; d.Kind == compare.OnlyInTo {
+			key = d.To
+		}
+		if d.Count > 1 {
+			copies = fmt.Sprintf(" %d times", d.Count)
+		}
+	}
+	switch d.Kind {
+	case compare.OnlyInFrom:
+		_, err = fmt.Fprintf(t.w, "- `%s` (%s) only in from%s\n", t.table.Name, formatRow(key), copies)
+	case compare.OnlyInTo:
+		_, err = fmt.Fprintf(t.w, "+ `%s` (%s) only in to%s\n", t.table.Name, formatRow(key), copies)
+	case compare.Changed:
+		changes := make([]string, len(d.From))
+		for i, f := range d.From {
+			changes[i] = fmt.Sprintf("%s: %s -> %s", f.Column, FormatValue(f.Value), FormatValue(d.To[i].Value))
+		}
+		_, err = fmt.Fprintf(t.w, "~ `%s` (%s) changed %s\n", t.table.Name, formatRow(key), strings.Join(changes, ", "))
+	}
+	return
+}
+
+func (t *textTable) Done(counts compare.Counts, failure error) (err error) {
+	if failure != nil {
+		return
+	}
+	_, err = fmt.Fprintf(t.w, "table `%s`: %d matched, %d only in from, %d only in to, %d changed\n", t.table.Name, counts.Matched, counts.OnlyInFrom, counts.OnlyInTo, counts.Changed)
+	return
+}
+
+func formatRow(row Row) string {
+	parts := make([]string, len(row))
+	for i, f := range row {
+		parts[i] = fmt.Sprintf("%s=%s", f.Column, FormatValue(f.Value))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// FormatValue quotes a value for people to read.
+func FormatValue(v []byte) string {
+	if v == nil {
+		return "NULL"
+	}
+	return fmt.Sprintf("%q", v)
+}
@@ -0,0 +1,117 @@
+package throttle
+
+import (
+	"context"
+
+	"sqlcmp/datasource"
+	"sqlcmp/datasource/schema"
+)
+
+// Iterator counts the rows scanned from iterator and their size against the
+// limits of the throttle. It sleeps while the query is open, which can run into
+// the timeouts of the server, so tables are read in ranges where they can be,
+// see Checksummer.
+func (t *Throttle) Iterator(ctx context.Context, iterator schema.RecordIterator) schema.RecordIterator {
+	if t == nil {
+		return iterator
+	}
+	return &throttledIterator{RecordIterator: iterator, ctx: ctx, throttle: t}
+}
+
+type throttledIterator struct {
+	schema.RecordIterator
+	ctx      context.Context
+	throttle *Throttle
+}
+
+func (i *throttledIterator) Scan(dest ...interface{}) (err error) {
+	if err = i.RecordIterator.Scan(dest...); err != nil {
+		return
+	}
+	return i.throttle.Wait(i.ctx, 1, size(dest))
+}
+
+// size estimates the bytes of a scanned row, numbers and times count as 8.
+func size(dest []interface{}) (n int64) {
+	for _, d := range dest {
+		v := d
+		if p, ok := d.(*interface{}); ok {
+			v = *p
+		}
+		switch v := v.(type) {
+		case nil:
+		case []byte:
+			n += int64(len(v))
+		case *[]byte:
+			n += int64(len(*v))
+		case string:
+			n += int64(len(v))
+		case *string:
+			n += int64(len(*v))
+		default:
+			n += 8
+		}
+	}
+	return
+}
+
+// Checksummer throttles the ranges that checksummer hashes by the number of
+// rows in them and the rows it reads. It sleeps between the queries of the
+// ranges, so no query is open while it does.
+func (t *Throttle) Checksummer(checksummer datasource.Checksummer) datasource.Checksummer {
+	if t == nil {
+		return checksummer
+	}
+	return &throttledChecksummer{Checksummer: checksummer, throttle: t}
+}
+
+type throttledChecksummer struct {
+	datasource.Checksummer
+	throttle *Throttle
+}
+
+func (c *throttledChecksummer) Checksum(ctx context.Context, table string, columns, key []string, r datasource.KeyRange) (sum string, count int64, err error) {
+	if sum, count, err = c.Checksummer.Checksum(ctx, table, columns, key, r); err != nil {
+		return
+	}
+	// the rows are read on the server, so only their number is known
+	err = c.throttle.Wait(ctx, count, 0)
+	return
+}
+
+func (c *throttledChecksummer) RangeIterator(ctx context.Context, table string, columns, key []string, r datasource.KeyRange) (iterator schema.RecordIterator, err error) {
+	if iterator, err = c.Checksummer.RangeIterator(ctx, table, columns, key, r); err != nil {
+		return
+	}
+	return &rangeIterator{RecordIterator: iterator, ctx: ctx, throttle: c.throttle}, nil
+}
+
+// rangeIterator counts the rows scanned from a range and waits for them once
+// the range is closed.
+type rangeIterator struct {
+	schema.RecordIterator
+	ctx         context.Context
+	throttle    *Throttle
+	rows, bytes int64
+	closed      bool
+}
+
+func (i *rangeIterator) Scan(dest ...interface{}) (err error) {
+	if err = i.RecordIterator.Scan(dest...); err != nil {
+		return
+	}
+	i.rows++
+	i.bytes += size(dest)
+	return
+}
+
+func (i *rangeIterator) Close() (err error) {
+	if i.closed {
+		return nil
+	}
+	i.closed = true
+	if err = i.RecordIterator.Close(); err != nil {
+		return
+	}
+	return i.throttle.Wait(i.ctx, i.rows, i.bytes)
+}
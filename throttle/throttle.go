@@ -0,0 +1,256 @@
+package throttle
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"sqlcmp/datasource"
+)
+
+// minSleep is the shortest delay that is slept, shorter ones are made up for
+// by the next rows.
+const minSleep = 10 * time.Millisecond
+
+// maxBurst is how far a source may fall behind its rate, e.g. while another
+// table is set up, before the time is lost instead of being made up in a burst.
+const maxBurst = time.Second
+
+type Options struct {
+	// RowsPerSecond and BytesPerSecond limit how fast rows are read, 0 doesn't
+	// limit them
+	RowsPerSecond  float64
+	BytesPerSecond float64
+	// ChunkRows is the number of rows after which ChunkSleep is slept
+	ChunkRows  int64
+	ChunkSleep time.Duration
+	// Check pauses the reads while the load of the source is too high
+	Check *Check
+}
+
+// Check is a query that returns the load of a source, e.g. the lag of a
+// replica or the number of running threads.
+type Check struct {
+	DB    datasource.Querier
+	Query string
+	// Column holds the load, the first column is used when it's empty. NULL
+	// counts as above the threshold, e.g. Seconds_Behind_Master of a replica
+	// that stopped.
+	Column    string
+	Threshold float64
+	// Interval is how often the load is checked, also while paused
+	Interval time.Duration
+}
+
+// Throttle slows down the reads of a source. It's shared by every table that's
+// read from the source, so the limits hold when tables are compared in
+// parallel. A nil Throttle doesn't slow anything down.
+type Throttle struct {
+	name string
+	opts Options
+	log  io.Writer
+
+	mu        sync.Mutex
+	rows      pacer
+	bytes     pacer
+	chunk     int64
+	lastCheck time.Time
+	// checking is closed when the running load check is done
+	checking chan struct{}
+	// pausedUntil is when the pause for a high load ends
+	pausedUntil time.Time
+}
+
+// New returns the throttle of the source called name, pauses are reported to
+// log.
+func New(name string, opts Options, log io.Writer) *Throttle {
+	return &Throttle{name: name, opts: opts, log: log, rows: pacer{rate: opts.RowsPerSecond}, bytes: pacer{rate: opts.BytesPerSecond}}
+}
+
+// Wait accounts for rows that were read and sleeps until reading them is within
+// the limits, or while the load of the source is too high. The lock is only
+// held to work out the delay, so the tables that share the throttle sleep at
+// the same time rather than one after the other.
+func (t *Throttle) Wait(ctx context.Context, rows, bytes int64) (err error) {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	now := time.Now()
+	delay := max(t.rows.add(now, float64(rows)), t.bytes.add(now, float64(bytes)))
+	if t.opts.ChunkRows > 0 && t.opts.ChunkSleep > 0 {
+		if t.chunk += rows; t.chunk >= t.opts.ChunkRows {
+			t.chunk %= t.opts.ChunkRows
+			delay += t.opts.ChunkSleep
+			t.pause(t.opts.ChunkSleep)
+		}
+	}
+	t.mu.Unlock()
+	if delay >= minSleep {
+		if err = t.sleep(ctx, delay); err != nil {
+			return
+		}
+	}
+	return t.check(ctx)
+}
+
+// check pauses until the load is below the threshold. The load is queried at
+// most once an interval by one caller, the others wait for its result and
+// pause along with it.
+func (t *Throttle) check(ctx context.Context) error {
+	check := t.opts.Check
+	if check == nil {
+		return nil
+	}
+	for {
+		t.mu.Lock()
+		if checking := t.checking; checking != nil {
+			t.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-checking:
+			}
+			continue
+		}
+		if paused := time.Until(t.pausedUntil); paused > 0 {
+			t.mu.Unlock()
+			if err := t.sleep(ctx, paused); err != nil {
+				return err
+			}
+			continue
+		}
+		if time.Since(t.lastCheck) < check.Interval {
+			t.mu.Unlock()
+			return nil
+		}
+		t.lastCheck = time.Now()
+		checking := make(chan struct{})
+		t.checking = checking
+		t.mu.Unlock()
+
+		load, err := check.load(ctx)
+		// NaN, a NULL load, isn't below the threshold either
+		high := err == nil && !(load <= check.Threshold)
+		t.mu.Lock()
+		if high {
+			t.pausedUntil = time.Now().Add(check.Interval)
+			t.pause(check.Interval)
+		}
+		t.checking = nil
+		close(checking)
+		t.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to check the load of %s:\n%w", t.name, err)
+		}
+		if !high {
+			return nil
+		}
+		value := "NULL"
+		if !math.IsNaN(load) {
+			value = strconv.FormatFloat(load, 'g', -1, 64)
+		}
+		fmt.Fprintf(t.log, "%s: load %s is above %g, pausing for %s\n", t.name, value, check.Threshold, check.Interval)
+	}
+}
+
+// pause keeps the rates from making up for a pause of d with a burst.
+func (t *Throttle) pause(d time.Duration) {
+	t.rows.shift(d)
+	t.bytes.shift(d)
+}
+
+func (t *Throttle) sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+	return nil
+}
+
+// load returns the value of the load column, or NaN when it's NULL.
+func (c *Check) load(ctx context.Context) (load float64, err error) {
+	rows, err := c.DB.QueryContext(ctx, c.Query)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return
+	}
+	index := 0
+	if c.Column != "" {
+		if index = indexOf(columns, c.Column); index < 0 {
+			return 0, fmt.Errorf("the load query has no column %s", c.Column)
+		}
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = errors.New("the load query returned no rows")
+		}
+		return
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return
+	}
+	if values[index] == nil {
+		return math.NaN(), nil
+	}
+	if load, err = strconv.ParseFloat(string(values[index]), 64); err != nil {
+		return 0, fmt.Errorf("the load %q isn't a number", values[index])
+	}
+	return
+}
+
+func indexOf(items []string, item string) int {
+	for i, v := range items {
+		if v == item {
+			return i
+		}
+	}
+	return -1
+}
+
+// pacer spreads an amount over time at a rate per second.
+type pacer struct {
+	rate  float64
+	start time.Time
+	done  float64
+}
+
+// add returns how long to wait for n more to be within the rate.
+func (p *pacer) add(now time.Time, n float64) time.Duration {
+	if p.rate <= 0 {
+		return 0
+	}
+	if p.start.IsZero() {
+		p.start = now
+	}
+	p.done += n
+	due := p.start.Add(time.Duration(p.done / p.rate * float64(time.Second)))
+	if behind := now.Sub(due); behind > maxBurst {
+		p.start = p.start.Add(behind - maxBurst)
+	}
+	return due.Sub(now)
+}
+
+func (p *pacer) shift(d time.Duration) {
+	if !p.start.IsZero() {
+		p.start = p.start.Add(d)
+	}
+}
@@ -0,0 +1,138 @@
+package throttle
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	db "sqlcmp/datasource"
+	"sqlcmp/datasource/dsn"
+	_ "sqlcmp/datasource/sqlite"
+)
+
+func TestWaitRates(t *testing.T) {
+	cases := map[string]struct {
+		opts     Options
+		expected time.Duration
+	}{
+		"rows":   {Options{RowsPerSecond: 1000}, 100 * time.Millisecond},
+		"bytes":  {Options{BytesPerSecond: 10000}, 100 * time.Millisecond},
+		"chunks": {Options{ChunkRows: 50, ChunkSleep: 50 * time.Millisecond}, 100 * time.Millisecond},
+	}
+	for name, c := range cases {
+		throttle := New(name, c.opts, io.Discard)
+		started := time.Now()
+		// 100 rows of 10 bytes
+		for i := 0; i < 100; i++ {
+			if err := throttle.Wait(context.Background(), 1, 10); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if took := time.Since(started); took < c.expected-minSleep || took > c.expected+500*time.Millisecond {
+			t.Errorf("%s: expected the rows to take about %s, took %s", name, c.expected, took)
+		}
+	}
+}
+
+func TestWaitParallel(t *testing.T) {
+	throttle := New("from", Options{ChunkRows: 1, ChunkSleep: 100 * time.Millisecond}, io.Discard)
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			throttle.Wait(context.Background(), 1, 0)
+		}()
+	}
+	wg.Wait()
+	if took := time.Since(started); took > 250*time.Millisecond {
+		t.Errorf("expected the waits to sleep at the same time, took %s", took)
+	}
+}
+
+func TestWaitCancel(t *testing.T) {
+	throttle := New("from", Options{RowsPerSecond: 1}, io.Discard)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := throttle.Wait(ctx, 10, 0); err != context.DeadlineExceeded {
+		t.Errorf("expected the wait to stop with the context, got %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	cfg, err := dsn.Parse("sqlite3://" + filepath.Join(t.TempDir(), "load.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := db.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	if _, err = source.DB().Exec("CREATE TABLE status (name TEXT, lag INTEGER); INSERT INTO status VALUES ('replica', 30)"); err != nil {
+		t.Fatal(err)
+	}
+	var log strings.Builder
+	throttle := New("to", Options{Check: &Check{DB: source.DB(), Query: "SELECT name, lag FROM status", Column: "lag", Threshold: 10, Interval: 20 * time.Millisecond}}, &log)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		source.DB().Exec("UPDATE status SET lag = 5")
+	}()
+	started := time.Now()
+	if err = throttle.Wait(context.Background(), 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if took := time.Since(started); took < 100*time.Millisecond {
+		t.Errorf("expected to pause until the lag dropped, took %s", took)
+	}
+	if !strings.HasPrefix(log.String(), "to: load 30 is above 10, pausing for 20ms\n") {
+		t.Errorf("unexpected log %q", log.String())
+	}
+
+	throttle = New("to", Options{Check: &Check{DB: source.DB(), Query: "SELECT name FROM status", Threshold: 10, Interval: time.Second}}, &log)
+	if err = throttle.Wait(context.Background(), 1, 0); err == nil || !strings.Contains(err.Error(), "isn't a number") {
+		t.Errorf("expected an error for a load that isn't a number, got %v", err)
+	}
+}
+
+func TestRangeIterator(t *testing.T) {
+	cfg, err := dsn.Parse("sqlite3://" + filepath.Join(t.TempDir(), "range.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := db.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+	if _, err = source.DB().Exec("CREATE TABLE t (id INTEGER PRIMARY KEY); INSERT INTO t VALUES (1), (2), (3), (4), (5), (6), (7), (8), (9), (10)"); err != nil {
+		t.Fatal(err)
+	}
+	throttle := New("from", Options{RowsPerSecond: 100}, io.Discard)
+	iterator, err := throttle.Checksummer(source.(db.Checksummer)).RangeIterator(context.Background(), "t", []string{"id"}, []string{"id"}, db.KeyRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	for iterator.Next() {
+		var id interface{}
+		if err = iterator.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if took := time.Since(started); took > 50*time.Millisecond {
+		t.Errorf("expected the range to be read without sleeping, took %s", took)
+	}
+	if err = iterator.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 10 rows at 100 a second
+	if took := time.Since(started); took < 100*time.Millisecond-minSleep {
+		t.Errorf("expected to sleep once the range was closed, took %s", took)
+	}
+}